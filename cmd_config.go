@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"ddns-dnspod/config"
+	"ddns-dnspod/dnspod"
+	"ddns-dnspod/servicerunner"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runConfigCommand handles `config <subcommand>` and returns the process exit code.
+func runConfigCommand(args []string, log *logrus.Logger) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: ddns-dnspod config check [-c config.toml] [-online]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Path to the config.toml file")
+	online := fs.Bool("online", false, "Also verify credentials and record IDs against the DNSPod API")
+	if err := fs.Parse(args[1:]); err != nil {
+		return flagExitCode(err)
+	}
+
+	configPath, err := config.ResolvePath(*configFile)
+	if err != nil {
+		log.Warnf("Could not determine the default config path: %v", err)
+	}
+	appCfg, err := loadCommandConfig(*configFile, log)
+	if err != nil {
+		log.Errorf("Failed to load configuration: %v", err)
+		return 1
+	}
+
+	reports := appCfg.Validate()
+	if *online {
+		if config.HasErrors(reports) {
+			reports = append(reports, config.FieldReport{Field: "DNSPod API", Status: config.StatusWarning, Message: "skipped because of the errors above"})
+		} else {
+			reports = append(reports, checkOnline(appCfg)...)
+		}
+	}
+
+	// Load falls back to the environment when the file is missing, so say
+	// so rather than naming a file that was never read.
+	switch _, statErr := os.Stat(configPath); {
+	case configPath == "":
+		fmt.Print("Configuration file: not found (using environment variables)\n\n")
+	case os.IsNotExist(statErr):
+		fmt.Printf("Configuration file: not found at %s (using environment variables)\n\n", configPath)
+	case statErr != nil:
+		fmt.Printf("Configuration file: %s cannot be read (using environment variables): %v\n\n", configPath, statErr)
+	default:
+		fmt.Printf("Configuration file: %s\n\n", configPath)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tFIELD\tDETAILS")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Status, r.Field, r.Message)
+	}
+	w.Flush()
+
+	if config.HasErrors(reports) {
+		fmt.Println("\nConfiguration has errors.")
+		return 1
+	}
+	fmt.Println("\nConfiguration is valid.")
+	return 0
+}
+
+// checkOnline looks up each configured record through the DNSPod API and
+// compares its type and subdomain with the configuration.
+func checkOnline(appCfg config.AppConfig) []config.FieldReport {
+	var reports []config.FieldReport
+	if err := servicerunner.UseProxies(appCfg); err != nil {
+		return append(reports, config.FieldReport{Field: "proxy (API)", Status: config.StatusError, Message: err.Error()})
+	}
+	if err := servicerunner.UseCredentials(appCfg); err != nil {
+		return append(reports, config.FieldReport{Field: "CREDENTIAL_SOURCE (API)", Status: config.StatusError, Message: err.Error()})
+	}
+	type configuredRecord struct {
+		field      string
+		id         int64
+		subDomain  string
+		recordType string
+	}
+	records := []configuredRecord{}
+	for _, rec := range []struct {
+		field, id, subDomain, recordType string
+	}{
+		{"DNSPOD_RECORDID_IPV4", appCfg.RecordIDIPv4, appCfg.SubDomainIPv4, "A"},
+		{"DNSPOD_RECORDID_IPV6", appCfg.RecordIDIPv6, appCfg.SubDomainIPv6, "AAAA"},
+	} {
+		if rec.id == "" {
+			continue
+		}
+		recordID, _ := config.ParseRecordID(rec.id) // Validate already rejected bad IDs
+		records = append(records, configuredRecord{rec.field, recordID, rec.subDomain, rec.recordType})
+	}
+	for i, rec := range appCfg.Records {
+		records = append(records, configuredRecord{fmt.Sprintf("record[%d].record_id", i), rec.RecordID, rec.SubDomain, rec.RecordType()})
+	}
+
+	accepted := false
+	for _, rec := range records {
+		record, err := dnspod.DescribeRecord(appCfg.SecretID, appCfg.SecretKey, appCfg.Domain, rec.id)
+		if err != nil {
+			if dnspod.IsAuthError(err) {
+				return append(reports, config.FieldReport{Field: "DNSPOD_SECRET_ID/KEY (API)", Status: config.StatusError, Message: err.Error()})
+			}
+			reports = append(reports, config.FieldReport{Field: rec.field + " (API)", Status: config.StatusError, Message: err.Error()})
+			continue
+		}
+		accepted = true
+
+		subDomain := rec.subDomain
+		if subDomain == "" {
+			subDomain = "@"
+		}
+		switch {
+		case record.Type != rec.recordType:
+			reports = append(reports, config.FieldReport{Field: rec.field + " (API)", Status: config.StatusError,
+				Message: fmt.Sprintf("record %d is of type %s, expected %s", record.ID, record.Type, rec.recordType)})
+		case record.SubDomain != subDomain:
+			reports = append(reports, config.FieldReport{Field: rec.field + " (API)", Status: config.StatusWarning,
+				Message: fmt.Sprintf("record %d belongs to %q but the subdomain is configured as %q; updates will rename it", record.ID, record.SubDomain, subDomain)})
+		default:
+			reports = append(reports, config.FieldReport{Field: rec.field + " (API)", Status: config.StatusOK,
+				Message: fmt.Sprintf("%s.%s %s %s (line %s, TTL %d)", record.SubDomain, appCfg.Domain, record.Type, record.Value, record.Line, record.TTL)})
+		}
+	}
+	// Errors other than authentication failures, such as a timeout, say
+	// nothing about the keys, so only a successful lookup confirms them.
+	credentials := config.FieldReport{Field: "DNSPOD_SECRET_ID/KEY (API)", Status: config.StatusOK, Message: "accepted by the DNSPod API"}
+	if !accepted {
+		credentials.Status = config.StatusWarning
+		credentials.Message = "not verified, no API call succeeded"
+	}
+	return append([]config.FieldReport{credentials}, reports...)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ddns-dnspod/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runEncryptSecret reads a secret from stdin and prints it encrypted for use
+// in config.toml, creating the machine-local key file on first use.
+func runEncryptSecret(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("encrypt-secret", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Config file whose ENCRYPTION_KEY_FILE to use")
+	keyFile := fs.String("key-file", "", "Key file (default: ENCRYPTION_KEY_FILE, or ddns-dnspod.key next to the executable)")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	path, err := encryptionKeyFile(*keyFile, *configFile)
+	if err != nil {
+		log.Errorf("Cannot determine the key file: %v", err)
+		return 1
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := config.CreateKeyFile(path); err != nil {
+			log.Errorf("Failed to create key file %s: %v", path, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Created key file %s. Keep it on this machine and out of backups shared with the config.\n", path)
+	}
+
+	fmt.Fprint(os.Stderr, "Secret to encrypt: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		if err != nil {
+			log.Errorf("Failed to read the secret: %v", err)
+		} else {
+			log.Error("No secret given")
+		}
+		return 1
+	}
+
+	blob, err := config.Encrypt(secret, path)
+	if err != nil {
+		log.Errorf("Encryption failed: %v", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "\nPut this in config.toml, e.g. DNSPOD_SECRET_KEY = \"<value>\":")
+	fmt.Println(blob)
+	return 0
+}
+
+// encryptionKeyFile picks the key file: the flag, then ENCRYPTION_KEY_FILE
+// from the environment or config file, then the default location.
+func encryptionKeyFile(flagValue, configFile string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if env := os.Getenv("ENCRYPTION_KEY_FILE"); env != "" {
+		return env, nil
+	}
+	if configPath, err := config.ResolvePath(configFile); err == nil {
+		// Decode only: Load would try to decrypt, which needs the key file.
+		if cfg, err := config.Decode(configPath); err == nil && cfg.EncryptionKeyFile != "" {
+			return cfg.EncryptionKeyFile, nil
+		}
+	}
+	return config.DefaultKeyFile()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"ddns-dnspod/config"
+	"ddns-dnspod/dnspod"
+	"ddns-dnspod/ipfetcher"
+	"ddns-dnspod/logger"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// runInit interactively builds a config.toml and returns the process exit code.
+func runInit(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Where to write config.toml (default: next to the executable)")
+	dryRun := fs.Bool("dry-run", false, "Do not create records or write the file; print what would be done")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	configPath, err := config.ResolvePath(*configFile)
+	if err != nil {
+		log.Errorf("Could not determine where to write config.toml: %v", err)
+		return 1
+	}
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), log: log, dryRun: *dryRun}
+	cfg, err := w.run(configPath)
+	if err != nil {
+		if errors.Is(err, errAborted) {
+			fmt.Println("Aborted, nothing was written.")
+			return 1
+		}
+		log.Errorf("init failed: %v", err)
+		return 1
+	}
+
+	if *dryRun {
+		data, err := config.Render(cfg)
+		if err != nil {
+			log.Errorf("Failed to render config: %v", err)
+			return 1
+		}
+		fmt.Printf("\n[dry-run] Would write %s:\n\n%s", configPath, data)
+		return 0
+	}
+	if err := config.WriteFile(configPath, cfg); err != nil {
+		log.Errorf("Failed to write %s: %v", configPath, err)
+		return 1
+	}
+	fmt.Printf("\nWrote %s. Run `config check -online` to verify it.\n", configPath)
+	return 0
+}
+
+var errAborted = errors.New("aborted by user")
+
+// wizard holds the state of one interactive init session.
+type wizard struct {
+	in     *bufio.Reader
+	log    *logrus.Logger
+	dryRun bool
+}
+
+func (w *wizard) run(configPath string) (config.AppConfig, error) {
+	var cfg config.AppConfig
+
+	if _, err := os.Stat(configPath); err == nil && !w.dryRun {
+		ok, err := w.confirm(fmt.Sprintf("%s already exists. Overwrite it?", configPath), false)
+		if err != nil {
+			return cfg, err
+		}
+		if !ok {
+			return cfg, errAborted
+		}
+	}
+
+	fmt.Println("Create an API key at https://console.cloud.tencent.com/cam/capi.")
+	var err error
+	if cfg.SecretID, err = w.ask("SecretId", os.Getenv("DNSPOD_SECRET_ID")); err != nil {
+		return cfg, err
+	}
+	if cfg.SecretKey, err = w.askSecret("SecretKey", os.Getenv("DNSPOD_SECRET_KEY")); err != nil {
+		return cfg, err
+	}
+	logger.AddSecrets(cfg.SecretID, cfg.SecretKey)
+
+	domains, err := dnspod.ListDomains(cfg.SecretID, cfg.SecretKey)
+	if err != nil {
+		return cfg, err
+	}
+	if len(domains) == 0 {
+		return cfg, errors.New("the account has no domains; add one in the DNSPod console first")
+	}
+	fmt.Println("\nDomains in this account:")
+	for i, d := range domains {
+		fmt.Printf("  %2d) %s (%d records, %s)\n", i+1, d.Name, d.RecordCount, d.Status)
+	}
+	index, err := w.choose("Domain", len(domains))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Domain = domains[index].Name
+
+	if cfg.RecordIDIPv4, cfg.SubDomainIPv4, err = w.pickRecord(cfg, "A", ipfetcher.IPv4URL); err != nil {
+		return cfg, err
+	}
+	if cfg.RecordIDIPv6, cfg.SubDomainIPv6, err = w.pickRecord(cfg, "AAAA", ipfetcher.IPv6URL); err != nil {
+		return cfg, err
+	}
+	// In dry-run mode new records are not created, so they have no ID yet.
+	if cfg.RecordIDIPv4 == "" && cfg.RecordIDIPv6 == "" && !w.dryRun {
+		return cfg, errors.New("no record selected; at least one A or AAAA record is required")
+	}
+	return cfg, nil
+}
+
+// pickRecord lets the user select an existing record of recordType, create a
+// new one, or skip. It returns the record ID and subdomain, both empty when skipped.
+func (w *wizard) pickRecord(cfg config.AppConfig, recordType, ipURL string) (string, string, error) {
+	records, err := dnspod.ListRecords(cfg.SecretID, cfg.SecretKey, cfg.Domain, recordType, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	fmt.Printf("\n%s records of %s:\n", recordType, cfg.Domain)
+	for i, r := range records {
+		fmt.Printf("  %2d) %-24s %-40s line %s, TTL %d\n", i+1, r.SubDomain, r.Value, r.Line, r.TTL)
+	}
+	fmt.Println("   n) create a new record")
+	fmt.Println("   s) skip")
+
+	for {
+		answer, err := w.ask(fmt.Sprintf("%s record to manage", recordType), "s")
+		if err != nil {
+			return "", "", err
+		}
+		switch strings.ToLower(answer) {
+		case "s":
+			return "", "", nil
+		case "n":
+			return w.createRecord(cfg, recordType, ipURL)
+		}
+		n, convErr := strconv.Atoi(answer)
+		if convErr == nil && n >= 1 && n <= len(records) {
+			r := records[n-1]
+			return strconv.FormatUint(r.ID, 10), r.SubDomain, nil
+		}
+		fmt.Printf("Please enter 1-%d, n or s.\n", len(records))
+	}
+}
+
+func (w *wizard) createRecord(cfg config.AppConfig, recordType, ipURL string) (string, string, error) {
+	subDomain, err := w.ask("Subdomain (@ for the domain itself)", "ddns")
+	if err != nil {
+		return "", "", err
+	}
+
+	// The record needs a value; use the current address so it is correct right away.
+	value, fetchErr := ipfetcher.GetCurrentIP(ipURL, w.log)
+	if fetchErr != nil {
+		fmt.Printf("Could not detect the current address: %v\n", fetchErr)
+	}
+	if value, err = w.ask("Initial value", value); err != nil {
+		return "", "", err
+	}
+
+	if w.dryRun {
+		dnspod.LogIntendedCreate(cfg.Domain, subDomain, recordType, value, 0, w.log)
+		return "", subDomain, nil
+	}
+	id, err := dnspod.CreateRecord(cfg.SecretID, cfg.SecretKey, cfg.Domain, subDomain, recordType, value, 0)
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Printf("Created %s record %d for %s.%s.\n", recordType, id, subDomain, cfg.Domain)
+	return strconv.FormatUint(id, 10), subDomain, nil
+}
+
+// ask prints a prompt and returns the trimmed answer, or def when the answer is empty.
+func (w *wizard) ask(prompt, def string) (string, error) {
+	for {
+		if def != "" {
+			fmt.Printf("%s [%s]: ", prompt, def)
+		} else {
+			fmt.Printf("%s: ", prompt)
+		}
+		line, err := w.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", errAborted
+			}
+			return "", err
+		}
+		if answer := strings.TrimSpace(line); answer != "" {
+			return answer, nil
+		}
+		if def != "" {
+			return def, nil
+		}
+	}
+}
+
+// askSecret is like ask, but does not echo the answer or show the default
+// when stdin is a terminal.
+func (w *wizard) askSecret(prompt, def string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return w.ask(prompt, def)
+	}
+	// Echo stays off if the process is interrupted while reading; turn it
+	// back on before exiting.
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", err
+	}
+	interrupt := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(interrupt, os.Interrupt)
+	defer func() {
+		signal.Stop(interrupt)
+		close(done)
+	}()
+	go func() {
+		select {
+		case <-interrupt:
+			term.Restore(fd, state)
+			fmt.Println()
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	for {
+		if def != "" {
+			fmt.Printf("%s [keep current, hidden]: ", prompt)
+		} else {
+			fmt.Printf("%s (hidden): ", prompt)
+		}
+		line, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			if err == io.EOF {
+				return "", errAborted
+			}
+			return "", err
+		}
+		if answer := strings.TrimSpace(string(line)); answer != "" {
+			return answer, nil
+		}
+		if def != "" {
+			return def, nil
+		}
+	}
+}
+
+func (w *wizard) choose(prompt string, count int) (int, error) {
+	for {
+		answer, err := w.ask(fmt.Sprintf("%s (1-%d)", prompt, count), "")
+		if err != nil {
+			return 0, err
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= count {
+			return n - 1, nil
+		}
+	}
+}
+
+func (w *wizard) confirm(prompt string, def bool) (bool, error) {
+	defAnswer := "n"
+	if def {
+		defAnswer = "y"
+	}
+	answer, err := w.ask(prompt+" (y/n)", defAnswer)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
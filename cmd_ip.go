@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"ddns-dnspod/ipfetcher"
+	"ddns-dnspod/servicerunner"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ipSourceReport is one row of the `ip` command output.
+type ipSourceReport struct {
+	Family     string `json:"family"`
+	Source     string `json:"source"`
+	Selected   bool   `json:"selected"` // The address an update cycle would publish
+	IP         string `json:"ip,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+	ASN        string `json:"asn,omitempty"`
+	Country    string `json:"country,omitempty"`
+	Continent  string `json:"continent,omitempty"`
+	NATMapping string `json:"nat_mapping,omitempty"` // STUN sources only
+	Error      string `json:"error,omitempty"`
+}
+
+// runIPCommand queries every configured IP source and returns the process exit code.
+func runIPCommand(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("ip", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Path to the config.toml file")
+	format := fs.String("o", "table", "Output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if err := checkFormat(*format); err != nil {
+		log.Error(err)
+		return 2
+	}
+
+	appCfg, err := loadCommandConfig(*configFile, log)
+	if err != nil {
+		log.Errorf("Failed to load configuration: %v", err)
+		return 1
+	}
+
+	updateCfg, _, err := servicerunner.BuildUpdateConfig(appCfg)
+	if err != nil {
+		log.Errorf("Invalid configuration: %v", err)
+		return 1
+	}
+	if err := servicerunner.UseProxies(appCfg); err != nil {
+		log.Errorf("Invalid proxy configuration: %v", err)
+		return 1
+	}
+
+	type sourceGroup struct {
+		name    string
+		sources []ipfetcher.Source
+	}
+	groups := []sourceGroup{
+		{"IPv4", updateCfg.IPv4Sources},
+		{"IPv6", updateCfg.IPv6Sources},
+	}
+	for _, rec := range updateCfg.Records {
+		// Each [[record]] detects its address over its own sources and binding.
+		groups = append(groups, sourceGroup{fmt.Sprintf("%s (record %d)", rec.Type, rec.RecordID), rec.Sources})
+	}
+
+	var reports []ipSourceReport
+	for _, group := range groups {
+		selected := false
+		for _, r := range ipfetcher.Probe(group.sources, log) {
+			report := ipSourceReport{
+				Family:     group.name,
+				Source:     r.Source,
+				IP:         r.Details.IP,
+				LatencyMs:  r.Latency.Milliseconds(),
+				ASN:        r.Details.ASN,
+				Country:    r.Details.Country,
+				Continent:  r.Details.Continent,
+				NATMapping: r.Details.NATMapping,
+			}
+			if r.Err != nil {
+				report.Error = r.Err.Error()
+			} else if !selected {
+				// Sources are tried in order, so the first success is what gets published.
+				report.Selected, selected = true, true
+			}
+			reports = append(reports, report)
+		}
+	}
+
+	headers := []string{"FAMILY", "SOURCE", "IP", "LATENCY", "ASN", "COUNTRY", "NAT", "ERROR"}
+	rows := make([][]string, 0, len(reports))
+	for _, r := range reports {
+		ip := r.IP
+		if r.Selected {
+			ip += " *"
+		}
+		rows = append(rows, []string{r.Family, r.Source, ip, (time.Duration(r.LatencyMs) * time.Millisecond).String(), r.ASN, r.Country, r.NATMapping, r.Error})
+	}
+	if err := writeOutput(os.Stdout, *format, reports, headers, rows); err != nil {
+		log.Errorf("Failed to write output: %v", err)
+		return 1
+	}
+	if *format == "table" {
+		fmt.Println("\n* address that would be published")
+	}
+	return 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"ddns-dnspod/dnspod"
+	"ddns-dnspod/servicerunner"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runDomainsCommand handles `domains list` and returns the process exit code.
+func runDomainsCommand(args []string, log *logrus.Logger) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "Usage: ddns-dnspod domains list [-c config.toml] [-o table|json|csv]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("domains list", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Path to the config.toml file")
+	format := fs.String("o", "table", "Output format: table, json or csv")
+	if err := fs.Parse(args[1:]); err != nil {
+		return flagExitCode(err)
+	}
+	if err := checkFormat(*format); err != nil {
+		log.Error(err)
+		return 2
+	}
+
+	appCfg, err := loadCommandConfig(*configFile, log)
+	if err != nil {
+		log.Errorf("Failed to load configuration: %v", err)
+		return 1
+	}
+	if err := servicerunner.UseProxies(appCfg); err != nil {
+		log.Errorf("Invalid proxy configuration: %v", err)
+		return 1
+	}
+	if err := servicerunner.UseCredentials(appCfg); err != nil {
+		log.Errorf("Failed to set up credentials: %v", err)
+		return 1
+	}
+	domains, err := dnspod.ListDomains(appCfg.SecretID, appCfg.SecretKey)
+	if err != nil {
+		log.Errorf("Failed to list domains: %v", err)
+		return 1
+	}
+
+	headers := []string{"ID", "NAME", "STATUS", "GRADE", "RECORDS", "UPDATED"}
+	rows := make([][]string, 0, len(domains))
+	for _, d := range domains {
+		rows = append(rows, []string{strconv.FormatUint(d.ID, 10), d.Name, d.Status, d.Grade, strconv.FormatUint(d.RecordCount, 10), d.UpdatedOn})
+	}
+	if err := writeOutput(os.Stdout, *format, domains, headers, rows); err != nil {
+		log.Errorf("Failed to write output: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// runRecordsCommand handles `records list` and returns the process exit code.
+func runRecordsCommand(args []string, log *logrus.Logger) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "Usage: ddns-dnspod records list [-c config.toml] [-d domain] [-type A] [-subdomain www] [-o table|json|csv]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("records list", flag.ContinueOnError)
+	configFile := fs.String("c", "", "Path to the config.toml file")
+	domain := fs.String("d", "", "Domain to list (default: DNSPOD_DOMAIN)")
+	recordType := fs.String("type", "", "Only list records of this type, e.g. A or AAAA")
+	subDomain := fs.String("subdomain", "", "Only list records of this subdomain")
+	format := fs.String("o", "table", "Output format: table, json or csv")
+	if err := fs.Parse(args[1:]); err != nil {
+		return flagExitCode(err)
+	}
+	if err := checkFormat(*format); err != nil {
+		log.Error(err)
+		return 2
+	}
+
+	appCfg, err := loadCommandConfig(*configFile, log)
+	if err != nil {
+		log.Errorf("Failed to load configuration: %v", err)
+		return 1
+	}
+	if err := servicerunner.UseProxies(appCfg); err != nil {
+		log.Errorf("Invalid proxy configuration: %v", err)
+		return 1
+	}
+	if err := servicerunner.UseCredentials(appCfg); err != nil {
+		log.Errorf("Failed to set up credentials: %v", err)
+		return 1
+	}
+	if *domain == "" {
+		*domain = appCfg.Domain
+	}
+	if *domain == "" {
+		log.Error("No domain given; use -d or set DNSPOD_DOMAIN.")
+		return 2
+	}
+
+	records, err := dnspod.ListRecords(appCfg.SecretID, appCfg.SecretKey, *domain, strings.ToUpper(*recordType), *subDomain)
+	if err != nil {
+		log.Errorf("Failed to list records of %s: %v", *domain, err)
+		return 1
+	}
+
+	headers := []string{"ID", "NAME", "TYPE", "LINE", "VALUE", "TTL", "STATUS", "UPDATED"}
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, []string{strconv.FormatUint(r.ID, 10), r.SubDomain, r.Type, r.Line, r.Value, strconv.FormatUint(r.TTL, 10), r.Status, r.UpdatedOn})
+	}
+	if err := writeOutput(os.Stdout, *format, records, headers, rows); err != nil {
+		log.Errorf("Failed to write output: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// checkFormat rejects output formats writeOutput does not support.
+func checkFormat(format string) error {
+	switch format {
+	case "table", "json", "csv":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q; use table, json or csv", format)
+}
+
+// writeOutput renders items as JSON, or headers and rows as an aligned table or CSV.
+func writeOutput(w io.Writer, format string, items interface{}, headers []string, rows [][]string) error {
+	switch format {
+	case "json":
+		// A nil slice encodes as null; an empty list should still be [].
+		if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+			items = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(headers)
+		cw.WriteAll(rows) // WriteAll flushes
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// flagExitCode maps a FlagSet.Parse error to an exit code; -h is not a failure.
+func flagExitCode(err error) int {
+	if err == flag.ErrHelp {
+		return 0
+	}
+	return 2
+}
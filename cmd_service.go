@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"ddns-dnspod/dnspod"
+	"ddns-dnspod/servicerunner"
+
+	"github.com/kardianos/service"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSystemdDependencies make the service wait for the network to be
+// configured, since the first update runs right after start.
+var defaultSystemdDependencies = []string{
+	"Wants=network-online.target",
+	"After=network-online.target",
+}
+
+// serviceOptions identify an installed service. They must match between
+// install and the later remove/status calls.
+type serviceOptions struct {
+	name        string
+	displayName string
+	userService bool
+}
+
+func addServiceFlags(fs *flag.FlagSet) *serviceOptions {
+	o := &serviceOptions{}
+	fs.StringVar(&o.name, "name", serviceName, "Service name")
+	fs.StringVar(&o.displayName, "display-name", serviceDisplayName, "Service display name")
+	fs.BoolVar(&o.userService, "user-service", false, "Manage a per-user service instead of a system service (systemd --user, launchd agent)")
+	return o
+}
+
+func (o *serviceOptions) serviceConfig() *service.Config {
+	cfg := newServiceConfig(o.name)
+	cfg.DisplayName = o.displayName
+	if o.userService {
+		cfg.Option["UserService"] = true
+	}
+	return cfg
+}
+
+// newServiceConfig returns the service definition shared by all commands.
+func newServiceConfig(name string) *service.Config {
+	return &service.Config{
+		Name:        name,
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		Option:      service.KeyValue{},
+	}
+}
+
+// newControlService creates a service handle for management commands that do
+// not run the update loop.
+func newControlService(cfg *service.Config, log *logrus.Logger) (service.Service, error) {
+	return service.New(servicerunner.NewProgram(log, dnspod.UpdateConfig{}, 0), cfg)
+}
+
+// stringList is a flag.Value collecting repeated flags.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// runInstall installs the service, recording runtime flags as service arguments
+// so the installed service uses the same config file and options.
+func runInstall(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	opts := addServiceFlags(fs)
+	configFile := fs.String("c", "", "Path to the config.toml file the service should use")
+	dryRun := fs.Bool("dry-run", false, "Install the service in dry-run mode")
+	userName := fs.String("user", "", "Run the service as this user (systemd and Windows)")
+	var dependencies stringList
+	fs.Var(&dependencies, "dependency", "Service dependency, repeatable. On systemd a [Unit] line such as \"After=docker.service\", on Windows a service name")
+	noDefaultDeps := fs.Bool("no-default-dependencies", false, "Do not add Wants/After=network-online.target on systemd")
+	logOpts := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	svcConfig := opts.serviceConfig()
+	svcConfig.UserName = *userName
+
+	if *configFile != "" {
+		// The service manager starts us in another working directory, so store an absolute path.
+		absPath, err := filepath.Abs(*configFile)
+		if err != nil {
+			log.Errorf("Failed to resolve config path %s: %v", *configFile, err)
+			return 1
+		}
+		if _, err := os.Stat(absPath); err != nil {
+			log.Warnf("Config file %s is not accessible yet: %v", absPath, err)
+		}
+		svcConfig.Arguments = append(svcConfig.Arguments, "-c", absPath)
+	}
+	if *dryRun {
+		svcConfig.Arguments = append(svcConfig.Arguments, "-dry-run")
+	}
+	svcConfig.Arguments = append(svcConfig.Arguments, logOpts.args()...)
+	if opts.name != serviceName {
+		// On Windows the running service must know the name it was registered under.
+		svcConfig.Arguments = append(svcConfig.Arguments, "-name", opts.name)
+	}
+
+	if runtime.GOOS == "linux" {
+		if !*noDefaultDeps {
+			svcConfig.Dependencies = append(svcConfig.Dependencies, defaultSystemdDependencies...)
+		}
+		// Lets `systemctl reload` trigger the SIGHUP config reload.
+		svcConfig.Option["ReloadSignal"] = "HUP"
+	}
+	svcConfig.Dependencies = append(svcConfig.Dependencies, dependencies...)
+
+	s, err := newControlService(svcConfig, log)
+	if err != nil {
+		log.Errorf("Failed to create service: %v", err)
+		return 1
+	}
+	if err := s.Install(); err != nil {
+		log.Errorf("Failed to install service: %v", err)
+		return 1
+	}
+	log.Infof("Service %s installed successfully with arguments %q.", opts.name, svcConfig.Arguments)
+	return 0
+}
+
+// runRemove uninstalls the service.
+func runRemove(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("remove", flag.ContinueOnError)
+	opts := addServiceFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
+	s, err := newControlService(opts.serviceConfig(), log)
+	if err != nil {
+		log.Errorf("Failed to create service: %v", err)
+		return 1
+	}
+	if err := s.Uninstall(); err != nil {
+		log.Errorf("Failed to remove service %s: %v", opts.name, err)
+		return 1
+	}
+	fmt.Printf("Service %s removed successfully.\n", opts.name)
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"ddns-dnspod/servicerunner"
+
+	"github.com/kardianos/service"
+	"github.com/sirupsen/logrus"
+)
+
+// statusReport is the output of the `status` command.
+type statusReport struct {
+	Service   string               `json:"service"`
+	Status    string               `json:"status"`
+	StateFile string               `json:"state_file"`
+	State     *servicerunner.State `json:"state,omitempty"`
+	Error     string               `json:"error,omitempty"`
+}
+
+// runStatus shows the installed service's running state together with the
+// persisted result of its last update cycle, and returns the process exit code:
+// 0 when the service is running and its last cycle succeeded, 1 otherwise.
+func runStatus(args []string, log *logrus.Logger) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	opts := addServiceFlags(fs)
+	configFile := fs.String("c", "", "Path to the config.toml file, used to find STATE_FILE")
+	stateFile := fs.String("state", "", "Path to the state file (default: STATE_FILE or next to the executable)")
+	format := fs.String("o", "table", "Output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if *format != "table" && *format != "json" {
+		log.Errorf("unknown output format %q; use table or json", *format)
+		return 2
+	}
+
+	report := statusReport{Service: opts.name}
+
+	s, err := newControlService(opts.serviceConfig(), log)
+	if err != nil {
+		log.Errorf("Failed to create service: %v", err)
+		return 1
+	}
+	svcStatus, err := s.Status()
+	switch {
+	case errors.Is(err, service.ErrNotInstalled):
+		report.Status = "not installed"
+	case err != nil:
+		report.Status = "unknown"
+		report.Error = err.Error()
+	case svcStatus == service.StatusRunning:
+		report.Status = "running"
+	case svcStatus == service.StatusStopped:
+		report.Status = "stopped"
+	default:
+		report.Status = "unknown"
+	}
+
+	report.StateFile = *stateFile
+	if report.StateFile == "" {
+		appCfg, err := loadCommandConfig(*configFile, log)
+		if err != nil {
+			log.Errorf("Failed to load configuration: %v", err)
+			return 1
+		}
+		report.StateFile = appCfg.StateFile
+	}
+	if report.StateFile == "" {
+		report.StateFile, _ = servicerunner.DefaultStatePath(opts.name)
+	}
+	if st, err := servicerunner.LoadState(report.StateFile); err == nil {
+		report.State = &st
+	} else if os.IsPermission(err) {
+		log.Warnf("Cannot read state file %s; it is only readable by the service's user, so run status as that user or with sudo", report.StateFile)
+	} else if !os.IsNotExist(err) {
+		log.Warnf("Failed to read state file %s: %v", report.StateFile, err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printStatus(report)
+	}
+
+	if report.Status != "running" || report.State == nil || report.State.LastError != "" {
+		return 1
+	}
+	return 0
+}
+
+func printStatus(r statusReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	status := r.Status
+	if r.Error != "" {
+		status += " (" + r.Error + ")"
+	}
+	fmt.Fprintf(w, "Service:\t%s\t%s\n", r.Service, status)
+	fmt.Fprintf(w, "State file:\t%s\t\n", r.StateFile)
+	st := r.State
+	if st == nil {
+		fmt.Fprintln(w, "Last run:\tnever (no state file)\t")
+		return
+	}
+	fmt.Fprintf(w, "Started:\t%s\tPID %d\n", formatTime(st.StartedAt), st.PID)
+	fmt.Fprintf(w, "Last run:\t%s\t\n", formatTime(st.LastRunAt))
+	fmt.Fprintf(w, "Last success:\t%s\t\n", formatTime(st.LastSuccessAt))
+	if st.LastError != "" {
+		fmt.Fprintf(w, "Last error:\t%s\t%s\n", formatTime(st.LastErrorAt), st.LastError)
+	}
+	if st.DryRun {
+		fmt.Fprintln(w, "Mode:\tdry-run\t")
+	}
+	type labelled struct {
+		label string
+		state servicerunner.FamilyState
+	}
+	families := []labelled{
+		{"IPv4 (A)", st.IPv4},
+		{"IPv6 (AAAA)", st.IPv6},
+	}
+	for _, rec := range st.Records {
+		label := fmt.Sprintf("%s %s", rec.SubDomain, rec.RecordType)
+		if rec.Line != "" {
+			label += " [" + rec.Line + "]"
+		}
+		families = append(families, labelled{label, rec})
+	}
+	for _, f := range families {
+		if f.state.RecordID == 0 {
+			fmt.Fprintf(w, "%s:\tnot configured\t\n", f.label)
+			continue
+		}
+		published := "nothing published yet"
+		if f.state.PublishedIP != "" {
+			published = fmt.Sprintf("published %s at %s", f.state.PublishedIP, formatTime(f.state.PublishedAt))
+		}
+		fmt.Fprintf(w, "%s:\trecord %d\t%s, detected %s\n", f.label, f.state.RecordID, published, orNone(f.state.DetectedIP))
+		if f.state.LastError != "" {
+			fmt.Fprintf(w, "\t\terror: %s\n", f.state.LastError)
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format("2006-01-02 15:04:05"), time.Since(t).Round(time.Second))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
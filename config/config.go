@@ -1,8 +1,15 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ddns-dnspod/ipfetcher"
+	"ddns-dnspod/proxy"
 
 	"github.com/BurntSushi/toml"
 	"github.com/sirupsen/logrus"
@@ -11,34 +18,318 @@ import (
 // AppConfig defines the configuration structure.
 // RecordIDs are kept as strings here to match TOML and env, conversion happens later.
 type AppConfig struct {
-	SecretID      string `toml:"DNSPOD_SECRET_ID"`
-	SecretKey     string `toml:"DNSPOD_SECRET_KEY"`
+	SecretID      string   `toml:"DNSPOD_SECRET_ID"`
+	SecretKey     string   `toml:"DNSPOD_SECRET_KEY"`
+	SecretIDFile  string   `toml:"DNSPOD_SECRET_ID_FILE"`  // Read SecretID from this file when DNSPOD_SECRET_ID is unset
+	SecretKeyFile string   `toml:"DNSPOD_SECRET_KEY_FILE"` // Read SecretKey from this file when DNSPOD_SECRET_KEY is unset
+	SecretCommand []string `toml:"SECRET_COMMAND"`         // Program printing the SecretKey, e.g. ["pass", "show", "dnspod"]
+	// Key file for "enc:v1:" values created by encrypt-secret; empty means ddns-dnspod.key next to the executable
+	EncryptionKeyFile string `toml:"ENCRYPTION_KEY_FILE"`
+
+	// Temporary credentials instead of long-lived keys; see dnspod.UseCredentials
+	CredentialSource string `toml:"CREDENTIAL_SOURCE"` // static (default), cvm_role, sts or chain
+	CVMRoleName      string `toml:"CVM_ROLE_NAME"`     // Empty means the role bound to the instance
+	MetadataURL      string `toml:"METADATA_URL"`      // Empty means the Tencent Cloud metadata service
+	STSRoleArn       string `toml:"STS_ROLE_ARN"`
+	STSSessionName   string `toml:"STS_SESSION_NAME"`
+	STSDuration      string `toml:"STS_DURATION"` // Go duration; empty means 2h
+
 	Domain        string `toml:"DNSPOD_DOMAIN"`
 	RecordIDIPv4  string `toml:"DNSPOD_RECORDID_IPV4"`  // Kept as string for initial loading
 	RecordIDIPv6  string `toml:"DNSPOD_RECORDID_IPV6"`  // Kept as string for initial loading
 	SubDomainIPv4 string `toml:"DNSPOD_SUBDOMAIN_IPV4"` // New field for IPv4 subdomain
 	SubDomainIPv6 string `toml:"DNSPOD_SUBDOMAIN_IPV6"` // New field for IPv6 subdomain
+	TTL           int64  `toml:"DNSPOD_TTL"`            // Both records; 0 keeps the current TTL
+
+	// Per-record settings. Unset values keep what the record has in DNSPod.
+	LineIPv4   string  `toml:"DNSPOD_LINE_IPV4"` // Line name (默认, 电信, 联通, 移动, 境外) or line ID such as "10=1"
+	LineIPv6   string  `toml:"DNSPOD_LINE_IPV6"`
+	TTLIPv4    int64   `toml:"DNSPOD_TTL_IPV4"` // Overrides DNSPOD_TTL
+	TTLIPv6    int64   `toml:"DNSPOD_TTL_IPV6"`
+	WeightIPv4 *int64  `toml:"DNSPOD_WEIGHT_IPV4"` // 0-100; 0 disables weighting
+	WeightIPv6 *int64  `toml:"DNSPOD_WEIGHT_IPV6"`
+	RemarkIPv4 *string `toml:"DNSPOD_REMARK_IPV4"` // "" removes the remark
+	RemarkIPv6 *string `toml:"DNSPOD_REMARK_IPV6"`
+
+	IPSourcesIPv4 []string         `toml:"IP_SOURCES_IPV4"` // URLs, stun: URIs, [[ip_source]] names or presets, tried in order; empty means ipfetcher.IPv4URL
+	IPSourcesIPv6 []string         `toml:"IP_SOURCES_IPV6"` // Tried in order; empty means ipfetcher.IPv6URL
+	Interval      string           `toml:"UPDATE_INTERVAL"` // Go duration such as "5m"; empty means DefaultInterval
+	StateFile     string           `toml:"STATE_FILE"`      // Where the last update result is saved; empty means next to the executable
+	Records       []RecordConfig   `toml:"record"`
+	NamedSources  []IPSourceConfig `toml:"ip_source"` // Referenced by name from IP_SOURCES_* and ip_sources
+	Proxy         ProxiesConfig    `toml:"proxy"`
+	Log           LogConfig        `toml:"log"`
+}
+
+// ProxiesConfig is the [proxy] table. IP detection and the DNSPod API are
+// configured separately, because a proxy hides the address being detected.
+type ProxiesConfig struct {
+	API         ProxyConfig `toml:"api"`
+	IPDetection ProxyConfig `toml:"ip_detection"`
+}
+
+// ProxyConfig is a [proxy.api] or [proxy.ip_detection] table.
+type ProxyConfig struct {
+	URL     string   `toml:"url"`      // http://, https://, socks5:// with optional user:password@, or "direct"; empty uses HTTP(S)_PROXY
+	NoProxy []string `toml:"no_proxy"` // Host names, IP addresses and CIDR ranges reached directly
+}
+
+// Settings converts c for the proxy package.
+func (c ProxyConfig) Settings() proxy.Settings {
+	return proxy.Settings{URL: c.URL, NoProxy: c.NoProxy}
+}
+
+// Secrets returns the proxy passwords, to be masked in logs.
+func (c ProxiesConfig) Secrets() []string {
+	return []string{proxy.Password(c.API.URL), proxy.Password(c.IPDetection.URL)}
+}
+
+// SourceSecrets returns the [[ip_source]] passwords and header values, to be
+// masked in logs.
+func (c AppConfig) SourceSecrets() []string {
+	var secrets []string
+	for _, src := range c.NamedSources {
+		secrets = append(secrets, src.Password)
+		for _, value := range src.Headers {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// IPSourceConfig is an [[ip_source]] table: an IP lookup with its own route,
+// so that each uplink and IP version is detected over the right path.
+type IPSourceConfig struct {
+	Name          string `toml:"name"`
+	Type          string `toml:"type"`           // http (default), dns, stun, upnp, natpmp, pcp, ubus, page, command or metadata
+	URL           string `toml:"url"`            // For http, ubus and page; for metadata, overrides the endpoint
+	Family        string `toml:"family"`         // ipv4 or ipv6; empty follows the list that uses it
+	Interface     string `toml:"interface"`      // Detect over this interface (SO_BINDTODEVICE on Linux)
+	SourceAddress string `toml:"source_address"` // Or from this local address
+
+	// For dns: servers answering with the querying address, e.g. OpenDNS
+	// for myip.opendns.com.
+	Resolvers []string `toml:"resolvers"`  // host or host:port, tried in order
+	QueryName string   `toml:"query_name"` // e.g. myip.opendns.com
+	QueryType string   `toml:"query_type"` // A, AAAA or TXT; empty follows the family
+
+	// For stun: STUN servers, host or host:port (3478 by default), tried in order.
+	Servers []string `toml:"servers"`
+
+	// For natpmp and pcp: the router, host or host:port (5351 by default);
+	// empty means the default gateway, found on Linux only.
+	Gateway string `toml:"gateway"`
+	// For upnp: the WANIPConnection control URL, skipping discovery, or
+	// where to send SSDP discovery instead of 239.255.255.250:1900.
+	ControlURL  string `toml:"control_url"`
+	SSDPAddress string `toml:"ssdp_address"`
+
+	// For ubus and page: the router login. Password may be an "enc:v1:"
+	// value from encrypt-secret.
+	Username string            `toml:"username"`
+	Password string            `toml:"password"`
+	Headers  map[string]string `toml:"headers"` // For page, e.g. a Cookie
+	// For page, how to find the address in the answer: a JSON path such as
+	// "wan.ipaddr" or a regex whose first group is the address. For ubus,
+	// json_path overrides reading ipv4-address/ipv6-address.
+	JSONPath string `toml:"json_path"`
+	Regex    string `toml:"regex"`
+	// For ubus: the OpenWrt interface, "wan" or "wan6" by default.
+	WANInterface string `toml:"wan_interface"`
+
+	// For command: the program and its arguments, run without a shell, and
+	// how long it may take (Go duration; empty means 10s).
+	Command []string `toml:"command"`
+	Timeout string   `toml:"timeout"`
+
+	// For metadata: the cloud provider, tencent, aws or gcp.
+	Provider string `toml:"provider"`
+}
+
+// SourceType returns the source type, defaulting to http.
+func (s IPSourceConfig) SourceType() string {
+	if s.Type == "" {
+		return "http"
+	}
+	return strings.ToLower(s.Type)
+}
+
+// MaxCommandTimeout is the longest timeout allowed for command sources.
+const MaxCommandTimeout = 5 * time.Minute
+
+// CommandTimeout returns the parsed timeout, or ipfetcher.DefaultCommandTimeout when it is not set.
+func (s IPSourceConfig) CommandTimeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return ipfetcher.DefaultCommandTimeout, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid duration such as \"10s\"", s.Timeout)
+	}
+	if d <= 0 || d > MaxCommandTimeout {
+		return 0, fmt.Errorf("%s must be positive and at most %s", d, MaxCommandTimeout)
+	}
+	return d, nil
+}
+
+// NamedSource returns the [[ip_source]] called name.
+func (c AppConfig) NamedSource(name string) (IPSourceConfig, bool) {
+	for _, src := range c.NamedSources {
+		if src.Name == name {
+			return src, true
+		}
+	}
+	return IPSourceConfig{}, false
+}
+
+// RecordConfig is a [[record]] table: an additional record with its own line
+// and IP source. Multi-WAN sites use one per carrier, e.g. the 电信 record
+// detected over the China Telecom uplink. Unset settings keep the live values.
+type RecordConfig struct {
+	RecordID  int64   `toml:"record_id"`
+	SubDomain string  `toml:"sub_domain"`
+	Type      string  `toml:"type"` // A (default) or AAAA
+	Line      string  `toml:"line"` // Line name such as 电信 or line ID such as "10=1"
+	TTL       int64   `toml:"ttl"`  // 0 uses DNSPOD_TTL, or keeps the current TTL
+	Weight    *int64  `toml:"weight"`
+	Remark    *string `toml:"remark"`
+
+	IPSources     []string `toml:"ip_sources"`     // URLs, stun: URIs, [[ip_source]] names or presets; empty means the built-in source for the type
+	Interface     string   `toml:"interface"`      // Detect the address over this interface, e.g. "ppp0"
+	SourceAddress string   `toml:"source_address"` // Or from this local address
+}
+
+// RecordType returns the record type, defaulting to A.
+func (r RecordConfig) RecordType() string {
+	if r.Type == "" {
+		return "A"
+	}
+	return strings.ToUpper(r.Type)
+}
+
+// LogConfig is the [log] table. Zero values keep the logger package defaults.
+type LogConfig struct {
+	Level       string `toml:"level"`  // trace, debug, info, warn, error
+	Format      string `toml:"format"` // text or json
+	Caller      *bool  `toml:"caller"` // Include file:line; default true
+	File        string `toml:"file"`   // Full path of the log file
+	Dir         string `toml:"dir"`    // Directory for ddns-server.log
+	DisableFile bool   `toml:"disable_file"`
+	MaxSizeMB   int    `toml:"max_size_mb"`
+	MaxBackups  int    `toml:"max_backups"`
+	MaxAgeDays  int    `toml:"max_age_days"`
+	Compress    bool   `toml:"compress"`
+	// Extra field names to mask in log output, on top of SecretId/SecretKey/token/password.
+	Redact []string `toml:"redact"`
+
+	Journald bool         `toml:"journald"` // Also log to the systemd journal (Linux)
+	Syslog   SyslogConfig `toml:"syslog"`
+}
+
+// SyslogConfig is the [log.syslog] table for forwarding logs in RFC 5424 format.
+type SyslogConfig struct {
+	URL                string `toml:"url"`      // udp://, tcp://, tls://host:port or unix:///dev/log; empty disables
+	AppName            string `toml:"app_name"` // Defaults to ddns-server
+	Facility           string `toml:"facility"` // Defaults to daemon
+	CAFile             string `toml:"ca_file"`
+	CertFile           string `toml:"cert_file"` // Client certificate for mutual TLS
+	KeyFile            string `toml:"key_file"`
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+}
+
+// AssumeRole accepts durations from 15 minutes to 12 hours.
+const (
+	MinSTSDuration = 15 * time.Minute
+	MaxSTSDuration = 12 * time.Hour
+)
+
+// Update interval limits. Intervals below MinInterval risk DNSPod API rate limits.
+const (
+	DefaultInterval = 5 * time.Minute
+	MinInterval     = 30 * time.Second
+)
+
+// UpdateInterval returns the parsed UPDATE_INTERVAL, or DefaultInterval when it is not set.
+func (c AppConfig) UpdateInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("UPDATE_INTERVAL %q is not a valid duration such as \"5m\"", c.Interval)
+	}
+	if d < MinInterval {
+		return 0, fmt.Errorf("UPDATE_INTERVAL %s is shorter than the minimum of %s", d, MinInterval)
+	}
+	return d, nil
+}
+
+// HasRecords reports whether at least one record is configured for updates.
+func (c AppConfig) HasRecords() bool {
+	return c.RecordIDIPv4 != "" || c.RecordIDIPv6 != "" || len(c.Records) > 0
+}
+
+// NeedsSecretKeys reports whether DNSPOD_SECRET_ID/DNSPOD_SECRET_KEY are
+// required: for static keys and as the identity calling STS AssumeRole.
+func (c AppConfig) NeedsSecretKeys() bool {
+	switch c.CredentialSource {
+	case "cvm_role", "chain":
+		return false
+	}
+	return true
+}
+
+// STSSessionDuration returns the parsed STS_DURATION, or 0 when unset.
+func (c AppConfig) STSSessionDuration() (time.Duration, error) {
+	if c.STSDuration == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.STSDuration)
+	if err != nil {
+		return 0, fmt.Errorf("STS_DURATION %q is not a valid duration such as \"2h\"", c.STSDuration)
+	}
+	if d < MinSTSDuration || d > MaxSTSDuration {
+		return 0, fmt.Errorf("STS_DURATION %s is outside the range %s-%s", d, MinSTSDuration, MaxSTSDuration)
+	}
+	return d, nil
+}
+
+// Decode reads the config file at path without applying environment variables.
+// Unlike Load it reports syntax errors instead of falling back to the environment.
+func Decode(path string) (AppConfig, error) {
+	var cfg AppConfig
+	_, err := toml.DecodeFile(path, &cfg)
+	return cfg, err
+}
+
+// ResolvePath returns the config file Load reads: configFileArg when set,
+// otherwise config.toml next to the executable.
+func ResolvePath(configFileArg string) (string, error) {
+	if configFileArg != "" {
+		return configFileArg, nil
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exePath), "config.toml"), nil
 }
 
 // Load loads configuration from the specified file path and environment variables.
 // Environment variables override file configurations.
 func Load(configFileArg string, logger *logrus.Logger) (AppConfig, error) {
 	var cfg AppConfig
-	configPath := configFileArg
-
-	if configPath == "" {
-		exePath, err := os.Executable()
-		if err == nil {
-			configPath = filepath.Join(filepath.Dir(exePath), "config.toml")
-		} else {
-			logger.Warnf("警告: 无法确定可执行文件路径以查找 config.toml: %v。将依赖环境变量。", err)
-		}
+	configPath, err := ResolvePath(configFileArg)
+	if err != nil {
+		logger.Warnf("警告: 无法确定可执行文件路径以查找 config.toml: %v。将依赖环境变量。", err)
 	}
 
 	if configPath != "" {
 		if _, statErr := os.Stat(configPath); statErr == nil {
 			if _, decodeErr := toml.DecodeFile(configPath, &cfg); decodeErr != nil {
 				logger.Warnf("警告: 读取配置文件 %s 失败: %v。将依赖环境变量。", configPath, decodeErr)
+			} else if permErr := checkConfigPermissions(configPath, cfg); permErr != nil {
+				return AppConfig{}, permErr
 			} else {
 				logger.Infof("成功从 %s 加载配置。", configPath)
 			}
@@ -53,7 +344,40 @@ func Load(configFileArg string, logger *logrus.Logger) (AppConfig, error) {
 		}
 	}
 
-	// Override with environment variables
+	// Override with environment variables. A *_FILE variable or SECRET_COMMAND
+	// in the environment replaces a secret from the config file, while the
+	// plain variable replaces both.
+	if envSecretIDFile := os.Getenv("DNSPOD_SECRET_ID_FILE"); envSecretIDFile != "" {
+		cfg.SecretIDFile = envSecretIDFile
+		cfg.SecretID = ""
+	}
+	if envSecretKeyFile := os.Getenv("DNSPOD_SECRET_KEY_FILE"); envSecretKeyFile != "" {
+		cfg.SecretKeyFile = envSecretKeyFile
+		cfg.SecretKey = ""
+	}
+	if envSecretCommand := os.Getenv("SECRET_COMMAND"); envSecretCommand != "" {
+		argv, err := splitSecretCommand(envSecretCommand)
+		if err != nil {
+			return AppConfig{}, err
+		}
+		cfg.SecretCommand = argv
+		cfg.SecretKey = ""
+	}
+	if envKeyFile := os.Getenv("ENCRYPTION_KEY_FILE"); envKeyFile != "" {
+		cfg.EncryptionKeyFile = envKeyFile
+	}
+	for env, field := range map[string]*string{
+		"CREDENTIAL_SOURCE": &cfg.CredentialSource,
+		"CVM_ROLE_NAME":     &cfg.CVMRoleName,
+		"METADATA_URL":      &cfg.MetadataURL,
+		"STS_ROLE_ARN":      &cfg.STSRoleArn,
+		"STS_SESSION_NAME":  &cfg.STSSessionName,
+		"STS_DURATION":      &cfg.STSDuration,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
 	if envSecretID := os.Getenv("DNSPOD_SECRET_ID"); envSecretID != "" {
 		cfg.SecretID = envSecretID
 	}
@@ -75,12 +399,135 @@ func Load(configFileArg string, logger *logrus.Logger) (AppConfig, error) {
 	if envSubDomainIPv6 := os.Getenv("DNSPOD_SUBDOMAIN_IPV6"); envSubDomainIPv6 != "" {
 		cfg.SubDomainIPv6 = envSubDomainIPv6
 	}
+	if envTTL := os.Getenv("DNSPOD_TTL"); envTTL != "" {
+		ttl, parseErr := strconv.ParseInt(envTTL, 10, 64)
+		if parseErr != nil {
+			logger.Warnf("警告: 环境变量 DNSPOD_TTL (%s) 不是有效的整数，已忽略: %v", envTTL, parseErr)
+		} else {
+			cfg.TTL = ttl
+		}
+	}
+	if envLineIPv4 := os.Getenv("DNSPOD_LINE_IPV4"); envLineIPv4 != "" {
+		cfg.LineIPv4 = envLineIPv4
+	}
+	if envLineIPv6 := os.Getenv("DNSPOD_LINE_IPV6"); envLineIPv6 != "" {
+		cfg.LineIPv6 = envLineIPv6
+	}
+	for env, field := range map[string]*int64{"DNSPOD_TTL_IPV4": &cfg.TTLIPv4, "DNSPOD_TTL_IPV6": &cfg.TTLIPv6} {
+		if v, ok := envInt(env, logger); ok {
+			*field = v
+		}
+	}
+	for env, field := range map[string]**int64{
+		"DNSPOD_WEIGHT_IPV4": &cfg.WeightIPv4, "DNSPOD_WEIGHT_IPV6": &cfg.WeightIPv6,
+	} {
+		if v, ok := envInt(env, logger); ok {
+			*field = &v
+		}
+	}
+	// LookupEnv, so that an empty variable can clear the remark.
+	if envRemarkIPv4, ok := os.LookupEnv("DNSPOD_REMARK_IPV4"); ok {
+		cfg.RemarkIPv4 = &envRemarkIPv4
+	}
+	if envRemarkIPv6, ok := os.LookupEnv("DNSPOD_REMARK_IPV6"); ok {
+		cfg.RemarkIPv6 = &envRemarkIPv6
+	}
+	if envSourcesIPv4 := os.Getenv("IP_SOURCES_IPV4"); envSourcesIPv4 != "" {
+		cfg.IPSourcesIPv4 = splitList(envSourcesIPv4)
+	}
+	if envSourcesIPv6 := os.Getenv("IP_SOURCES_IPV6"); envSourcesIPv6 != "" {
+		cfg.IPSourcesIPv6 = splitList(envSourcesIPv6)
+	}
+	if envInterval := os.Getenv("UPDATE_INTERVAL"); envInterval != "" {
+		cfg.Interval = envInterval
+	}
+	if envStateFile := os.Getenv("STATE_FILE"); envStateFile != "" {
+		cfg.StateFile = envStateFile
+	}
+	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
+		cfg.Log.Level = envLogLevel
+	}
+	if envLogFormat := os.Getenv("LOG_FORMAT"); envLogFormat != "" {
+		cfg.Log.Format = envLogFormat
+	}
+	if envLogFile := os.Getenv("LOG_FILE"); envLogFile != "" {
+		cfg.Log.File = envLogFile
+	}
+	if envLogDir := os.Getenv("LOG_DIR"); envLogDir != "" {
+		cfg.Log.Dir = envLogDir
+	}
+	if envDisable := os.Getenv("LOG_DISABLE_FILE"); envDisable != "" {
+		disable, parseErr := strconv.ParseBool(envDisable)
+		if parseErr != nil {
+			logger.Warnf("警告: 环境变量 LOG_DISABLE_FILE (%s) 不是有效的布尔值，已忽略: %v", envDisable, parseErr)
+		} else {
+			cfg.Log.DisableFile = disable
+		}
+	}
+	if envJournald := os.Getenv("LOG_JOURNALD"); envJournald != "" {
+		journald, parseErr := strconv.ParseBool(envJournald)
+		if parseErr != nil {
+			logger.Warnf("警告: 环境变量 LOG_JOURNALD (%s) 不是有效的布尔值，已忽略: %v", envJournald, parseErr)
+		} else {
+			cfg.Log.Journald = journald
+		}
+	}
+	if envSyslogURL := os.Getenv("LOG_SYSLOG_URL"); envSyslogURL != "" {
+		cfg.Log.Syslog.URL = envSyslogURL
+	}
+	for _, p := range []struct {
+		env string
+		cfg *ProxyConfig
+	}{
+		{"PROXY_API", &cfg.Proxy.API},
+		{"PROXY_IP_DETECTION", &cfg.Proxy.IPDetection},
+	} {
+		if envURL := os.Getenv(p.env + "_URL"); envURL != "" {
+			p.cfg.URL = envURL
+		}
+		if envNoProxy := os.Getenv(p.env + "_NO_PROXY"); envNoProxy != "" {
+			p.cfg.NoProxy = splitList(envNoProxy)
+		}
+	}
+
+	if err := resolveSecrets(&cfg); err != nil {
+		return cfg, err
+	}
+	if err := decryptSecrets(&cfg); err != nil {
+		return cfg, err
+	}
 
 	// Basic validation
-	if cfg.SecretID == "" || cfg.SecretKey == "" || cfg.Domain == "" || (cfg.RecordIDIPv4 == "" && cfg.RecordIDIPv6 == "") {
-		errMsg := "警告: DNSPOD_SECRET_ID, DNSPOD_SECRET_KEY, DNSPOD_DOMAIN, 或至少一个 DNSPOD_RECORDID_IPV4/DNSPOD_RECORDID_IPV6 未在配置文件或环境变量中完全设置。"
+	if (cfg.NeedsSecretKeys() && (cfg.SecretID == "" || cfg.SecretKey == "")) || cfg.Domain == "" || !cfg.HasRecords() {
+		errMsg := "警告: DNSPOD_SECRET_ID, DNSPOD_SECRET_KEY, DNSPOD_DOMAIN, 或至少一个 DNSPOD_RECORDID_IPV4/DNSPOD_RECORDID_IPV6 未在配置文件或环境变量中完全设置。可运行 `config check` 查看详细信息。"
 		logger.Warn(errMsg)
 	}
 
 	return cfg, nil
 }
+
+// envInt parses the integer environment variable name. Invalid values are
+// logged and ignored, like the other environment overrides.
+func envInt(name string, logger *logrus.Logger) (int64, bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		logger.Warnf("警告: 环境变量 %s (%s) 不是有效的整数，已忽略: %v", name, value, err)
+		return 0, false
+	}
+	return v, true
+}
+
+// splitList splits a comma-separated environment value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+)
+
+// secretFields are masked in Diff output, matched by their TOML key.
+var secretFields = map[string]bool{"DNSPOD_SECRET_KEY": true, "password": true, "headers": true}
+
+// urlFields are shown in Diff output with any password masked.
+var urlFields = map[string]bool{"proxy.api.url": true, "proxy.ip_detection.url": true}
+
+// Diff lists the fields that differ between old and new as "FIELD: old -> new",
+// using the TOML key names, with tables flattened to "table.key". Secret values are masked.
+func Diff(old, new AppConfig) []string {
+	return diffStruct("", reflect.ValueOf(old), reflect.ValueOf(new))
+}
+
+func diffStruct(prefix string, ov, nv reflect.Value) []string {
+	var changes []string
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		a, b := ov.Field(i), nv.Field(i)
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			continue
+		}
+		key := field.Tag.Get("toml")
+		if key == "" {
+			key = field.Name
+		}
+		name := prefix + key
+		if field.Type.Kind() == reflect.Struct {
+			changes = append(changes, diffStruct(name+".", a, b)...)
+			continue
+		}
+		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			changes = append(changes, diffTables(name, a, b)...)
+			continue
+		}
+		if secretFields[key] {
+			changes = append(changes, fmt.Sprintf("%s: (changed)", name))
+			continue
+		}
+		if urlFields[name] {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, displayURL(a.String()), displayURL(b.String())))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, display(a), display(b)))
+	}
+	return changes
+}
+
+// diffTables compares arrays of tables such as [[record]] entry by entry,
+// reporting entries as "name[i]".
+func diffTables(name string, ov, nv reflect.Value) []string {
+	var changes []string
+	for i := 0; i < ov.Len() || i < nv.Len(); i++ {
+		entry := fmt.Sprintf("%s[%d]", name, i)
+		switch {
+		case i >= nv.Len():
+			changes = append(changes, entry+": removed")
+		case i >= ov.Len():
+			changes = append(changes, entry+": added")
+		default:
+			changes = append(changes, diffStruct(entry+".", ov.Index(i), nv.Index(i))...)
+		}
+	}
+	return changes
+}
+
+func display(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "(unset)"
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String && v.String() == "" {
+		return `""`
+	}
+	return v.Interface()
+}
+
+func displayURL(raw string) string {
+	if raw == "" {
+		return `""`
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// encryptedPrefix marks a value produced by Encrypt: enc:v1:base64(nonce || AES-256-GCM ciphertext).
+const encryptedPrefix = "enc:v1:"
+
+// keyFileSize is the number of random bytes written to a new key file.
+const keyFileSize = 32
+
+// keyInfo separates keys derived for config secrets from any other use of the key file.
+const keyInfo = "ddns-dnspod config secret v1"
+
+// IsEncrypted reports whether value is an encrypted blob produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// DefaultKeyFile returns the key file used when ENCRYPTION_KEY_FILE is not
+// set: ddns-dnspod.key next to the executable.
+func DefaultKeyFile() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exePath), "ddns-dnspod.key"), nil
+}
+
+// CreateKeyFile writes a new random key to path with mode 0600. It never
+// overwrites an existing file, since that would make existing blobs unreadable.
+func CreateKeyFile(path string) error {
+	key := make([]byte, keyFileSize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(base64.StdEncoding.EncodeToString(key) + "\n")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Encrypt encrypts plaintext with the key derived from keyFile.
+func Encrypt(plaintext, keyFile string) (string, error) {
+	aead, err := newAEAD(keyFile)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(value, keyFile string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	aead, err := newAEAD(keyFile)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value: too short")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("key file %s cannot decrypt the value; it was encrypted on another machine or with another key file", keyFile)
+	}
+	return string(plaintext), nil
+}
+
+// newAEAD derives an AES-256-GCM key from the contents of keyFile.
+func newAEAD(keyFile string) (cipher.AEAD, error) {
+	if err := checkKeyFilePermissions(keyFile); err != nil {
+		return nil, err
+	}
+	material, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(material) < keyFileSize {
+		return nil, fmt.Errorf("key file %s is too short", keyFile)
+	}
+	key, err := hkdf.Key(sha256.New, material, nil, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkKeyFilePermissions refuses a key file other users can read, which
+// would defeat encrypting the config. See checkConfigPermissions.
+func checkKeyFilePermissions(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	if info.Mode().Perm()&otherReadable != 0 {
+		return fmt.Errorf("key file %s is readable by other users (mode %04o); run `chmod 600 %s`", path, info.Mode().Perm(), path)
+	}
+	return nil
+}
+
+// decryptSecrets replaces encrypted SecretID/SecretKey and [[ip_source]]
+// password values with their plaintext.
+func decryptSecrets(cfg *AppConfig) error {
+	type secret struct {
+		name  string
+		value *string
+	}
+	secrets := []secret{{"DNSPOD_SECRET_ID", &cfg.SecretID}, {"DNSPOD_SECRET_KEY", &cfg.SecretKey}}
+	for i := range cfg.NamedSources {
+		secrets = append(secrets, secret{fmt.Sprintf("ip_source[%d].password", i), &cfg.NamedSources[i].Password})
+	}
+	var encrypted []secret
+	for _, s := range secrets {
+		if IsEncrypted(*s.value) {
+			encrypted = append(encrypted, s)
+		}
+	}
+	if len(encrypted) == 0 {
+		return nil
+	}
+	keyFile := cfg.EncryptionKeyFile
+	if keyFile == "" {
+		var err error
+		if keyFile, err = DefaultKeyFile(); err != nil {
+			return fmt.Errorf("cannot locate the encryption key file: %w", err)
+		}
+	}
+	for _, s := range encrypted {
+		plaintext, err := Decrypt(*s.value, keyFile)
+		if err != nil {
+			return fmt.Errorf("%w (in %s)", err, s.name)
+		}
+		*s.value = plaintext
+	}
+	return nil
+}
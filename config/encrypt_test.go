@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newKeyFile creates a key file in a fresh directory.
+func newKeyFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ddns-dnspod.key")
+	if err := CreateKeyFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	keyFile := newKeyFile(t)
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+		}
+	}
+	if err := CreateKeyFile(keyFile); err == nil {
+		t.Error("CreateKeyFile overwrote an existing key file")
+	}
+
+	for _, plaintext := range []string{"secret-key", "", "密钥 with spaces\n"} {
+		blob, err := Encrypt(plaintext, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(blob) || (plaintext != "" && strings.Contains(blob, plaintext)) {
+			t.Errorf("Encrypt(%q) = %q", plaintext, blob)
+		}
+		got, err := Decrypt(blob, keyFile)
+		if err != nil || got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+
+	a, _ := Encrypt("same", keyFile)
+	b, _ := Encrypt("same", keyFile)
+	if a == b {
+		t.Error("encrypting the same value twice gave the same blob; the nonce is not random")
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	keyFile := newKeyFile(t)
+	blob, err := Encrypt("secret-key", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(blob, encryptedPrefix))
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+
+	shortKey := filepath.Join(t.TempDir(), "short.key")
+	if err := os.WriteFile(shortKey, []byte("abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, value, keyFile, wantErr string
+	}{
+		{"wrong key", blob, newKeyFile(t), "cannot decrypt the value"},
+		{"tampered ciphertext", encryptedPrefix + base64.StdEncoding.EncodeToString(tampered), keyFile, "cannot decrypt the value"},
+		{"too short", encryptedPrefix + base64.StdEncoding.EncodeToString(data[:4]), keyFile, "too short"},
+		{"not base64", encryptedPrefix + "%%%", keyFile, "malformed encrypted value"},
+		{"missing key file", blob, filepath.Join(t.TempDir(), "missing.key"), "failed to read key file"},
+		{"short key file", blob, shortKey, "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.value, tt.keyFile)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decrypt() = %q, %v; want error %q", got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not checked on Windows")
+	}
+	keyFile := newKeyFile(t)
+	blob, err := Encrypt("secret-key", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []os.FileMode{0640, 0604, 0644} {
+		if err := os.Chmod(keyFile, mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Decrypt(blob, keyFile); err == nil || !strings.Contains(err.Error(), "readable by other users") {
+			t.Errorf("mode %04o: Decrypt() error = %v, want the key file refused", mode, err)
+		}
+		if _, err := Encrypt("x", keyFile); err == nil {
+			t.Errorf("mode %04o: Encrypt() accepted the key file", mode)
+		}
+	}
+	if err := os.Chmod(keyFile, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(blob, keyFile); err != nil {
+		t.Errorf("mode 0400: Decrypt() error = %v", err)
+	}
+}
+
+func TestDecryptSecrets(t *testing.T) {
+	keyFile := newKeyFile(t)
+	key, _ := Encrypt("secret-key", keyFile)
+	password, _ := Encrypt("router-password", keyFile)
+	cfg := AppConfig{
+		SecretID:          "AKIDplain",
+		SecretKey:         key,
+		EncryptionKeyFile: keyFile,
+		NamedSources:      []IPSourceConfig{{Name: "a"}, {Name: "router", Password: password}},
+	}
+	if err := decryptSecrets(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SecretID != "AKIDplain" || cfg.SecretKey != "secret-key" || cfg.NamedSources[1].Password != "router-password" {
+		t.Errorf("decryptSecrets() = %q, %q, %q", cfg.SecretID, cfg.SecretKey, cfg.NamedSources[1].Password)
+	}
+
+	cfg = AppConfig{EncryptionKeyFile: newKeyFile(t), NamedSources: []IPSourceConfig{{Password: password}}}
+	if err := decryptSecrets(&cfg); err == nil || !strings.Contains(err.Error(), "ip_source[0].password") {
+		t.Errorf("decryptSecrets() with another key = %v, want an error naming ip_source[0].password", err)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"ddns-dnspod/proxy"
+)
+
+// secretCommandTimeout bounds how long SECRET_COMMAND may run.
+const secretCommandTimeout = 30 * time.Second
+
+// resolveSecrets fills SecretID and SecretKey from DNSPOD_SECRET_ID_FILE,
+// DNSPOD_SECRET_KEY_FILE and SECRET_COMMAND when they are not set directly.
+// A value set in the config file or environment always wins.
+func resolveSecrets(cfg *AppConfig) error {
+	if cfg.SecretID == "" && cfg.SecretIDFile != "" {
+		id, err := readSecretFile(cfg.SecretIDFile)
+		if err != nil {
+			return fmt.Errorf("DNSPOD_SECRET_ID_FILE: %w", err)
+		}
+		cfg.SecretID = id
+	}
+	if cfg.SecretKey == "" && cfg.SecretKeyFile != "" {
+		key, err := readSecretFile(cfg.SecretKeyFile)
+		if err != nil {
+			return fmt.Errorf("DNSPOD_SECRET_KEY_FILE: %w", err)
+		}
+		cfg.SecretKey = key
+	}
+	if cfg.SecretKey == "" && len(cfg.SecretCommand) > 0 {
+		key, err := runSecretCommand(cfg.SecretCommand)
+		if err != nil {
+			return fmt.Errorf("SECRET_COMMAND: %w", err)
+		}
+		cfg.SecretKey = key
+	}
+	return nil
+}
+
+// readSecretFile returns the contents of a Docker/Kubernetes style secret file
+// without the trailing newline.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+// runSecretCommand runs a helper such as `pass show dnspod/secret-key` and
+// returns the first line of its output. The command is run directly, not
+// through a shell.
+func runSecretCommand(argv []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s did not finish within %s", argv[0], secretCommandTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", argv[0], err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", argv[0], err)
+	}
+
+	secret, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("%s printed nothing", argv[0])
+	}
+	return secret, nil
+}
+
+// splitSecretCommand splits SECRET_COMMAND from the environment on
+// whitespace. Quoting is not supported, so arguments with spaces need the
+// array form in config.toml or a wrapper script; quotes are rejected rather
+// than passed on literally.
+func splitSecretCommand(value string) ([]string, error) {
+	if strings.ContainsAny(value, `"'`) {
+		return nil, errors.New("SECRET_COMMAND in the environment is split on spaces and cannot contain quotes; " +
+			"set it as an array in config.toml, e.g. SECRET_COMMAND = [\"pass\", \"show\", \"dnspod key\"], or use a wrapper script")
+	}
+	return strings.Fields(value), nil
+}
+
+// otherReadable are the mode bits that let users other than the owner read
+// a file. Config files with plaintext secrets and key files must have none.
+const otherReadable os.FileMode = 0044
+
+// errOtherReadable is returned by Load for config files that users other
+// than the owner can read.
+var errOtherReadable = errors.New("contains plaintext secrets but is readable by other users")
+
+// plaintextSecrets names the fields of cfg that hold an unencrypted secret.
+func plaintextSecrets(cfg AppConfig) []string {
+	var names []string
+	if cfg.SecretKey != "" && !IsEncrypted(cfg.SecretKey) {
+		names = append(names, "DNSPOD_SECRET_KEY")
+	}
+	for i, src := range cfg.NamedSources {
+		if src.Password != "" && !IsEncrypted(src.Password) {
+			names = append(names, fmt.Sprintf("ip_source[%d].password", i))
+		}
+		if len(src.Headers) > 0 {
+			names = append(names, fmt.Sprintf("ip_source[%d].headers", i))
+		}
+	}
+	if proxy.Password(cfg.Proxy.API.URL) != "" {
+		names = append(names, "proxy.api.url")
+	}
+	if proxy.Password(cfg.Proxy.IPDetection.URL) != "" {
+		names = append(names, "proxy.ip_detection.url")
+	}
+	return names
+}
+
+// checkConfigPermissions refuses a config file holding plaintext secrets
+// when users other than the owner, including its group, can read it.
+// Windows has no equivalent mode bits, so the check only applies elsewhere.
+func checkConfigPermissions(path string, cfg AppConfig) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	names := plaintextSecrets(cfg)
+	if len(names) == 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&otherReadable != 0 {
+		hint := "encrypt the passwords with encrypt-secret"
+		if names[0] == "DNSPOD_SECRET_KEY" {
+			hint = "encrypt the secrets with encrypt-secret, or move the SecretKey to DNSPOD_SECRET_KEY_FILE or SECRET_COMMAND"
+		}
+		return fmt.Errorf("%s %w (%s; mode %04o); run `chmod 600 %s` or %s",
+			path, errOtherReadable, strings.Join(names, ", "), info.Mode().Perm(), path, hint)
+	}
+	return nil
+}
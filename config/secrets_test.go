@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfigPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not checked on Windows")
+	}
+	tests := []struct {
+		name  string
+		cfg   AppConfig
+		field string // Reported field; empty means the file is accepted
+	}{
+		{name: "no secrets", cfg: AppConfig{SecretID: "AKID"}},
+		{name: "secret key", cfg: AppConfig{SecretKey: "key"}, field: "DNSPOD_SECRET_KEY"},
+		{name: "encrypted secret key", cfg: AppConfig{SecretKey: "enc:v1:abc"}},
+		{name: "source password", cfg: AppConfig{NamedSources: []IPSourceConfig{{Name: "a"}, {Name: "router", Password: "pw"}}},
+			field: "ip_source[1].password"},
+		{name: "encrypted source password", cfg: AppConfig{NamedSources: []IPSourceConfig{{Password: "enc:v1:abc"}}}},
+		{name: "source headers", cfg: AppConfig{NamedSources: []IPSourceConfig{{Headers: map[string]string{"Authorization": "Bearer x"}}}},
+			field: "ip_source[0].headers"},
+		{name: "API proxy password", cfg: AppConfig{Proxy: ProxiesConfig{API: ProxyConfig{URL: "http://user:pw@proxy:3128"}}},
+			field: "proxy.api.url"},
+		{name: "detection proxy password", cfg: AppConfig{Proxy: ProxiesConfig{IPDetection: ProxyConfig{URL: "socks5://user:pw@proxy:1080"}}},
+			field: "proxy.ip_detection.url"},
+		{name: "proxy without password", cfg: AppConfig{Proxy: ProxiesConfig{API: ProxyConfig{URL: "http://proxy:3128"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			// Readable by everyone, then by the group only.
+			for _, mode := range []os.FileMode{0644, 0640} {
+				if err := os.Chmod(path, mode); err != nil {
+					t.Fatal(err)
+				}
+				err := checkConfigPermissions(path, tt.cfg)
+				if tt.field == "" {
+					if err != nil {
+						t.Fatalf("mode %04o: unexpected error: %v", mode, err)
+					}
+					continue
+				}
+				if !errors.Is(err, errOtherReadable) || !strings.Contains(err.Error(), tt.field) {
+					t.Fatalf("mode %04o: error = %v, want errOtherReadable naming %s", mode, err, tt.field)
+				}
+			}
+			if tt.field == "" {
+				return
+			}
+			// The same file is fine once only the owner can read it.
+			if err := os.Chmod(path, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkConfigPermissions(path, tt.cfg); err != nil {
+				t.Errorf("mode 0600: %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitSecretCommand(t *testing.T) {
+	argv, err := splitSecretCommand("  pass show  dnspod/secret-key ")
+	if err != nil || strings.Join(argv, "|") != "pass|show|dnspod/secret-key" {
+		t.Errorf("got %q, %v", argv, err)
+	}
+	for _, value := range []string{`pass show "dnspod key"`, `sh -c 'pass show x'`} {
+		if _, err := splitSecretCommand(value); err == nil {
+			t.Errorf("%s: expected quotes to be rejected", value)
+		}
+	}
+}
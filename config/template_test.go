@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestRenderRoundTrip(t *testing.T) {
+	cfg := AppConfig{
+		SecretID:      "AKID\a\v\x00\x1f\x7f",
+		SecretKey:     `quote" backslash\ tab` + "\t newline\n cr\r ff\f bs\b",
+		Domain:        "例子.测试",
+		RecordIDIPv4:  "123",
+		SubDomainIPv4: "\xff@", // Not UTF-8; TOML files must be
+		RecordIDIPv6:  "456",
+		SubDomainIPv6: "$ {{ }}",
+		TTL:           600,
+		Interval:      "5m",
+	}
+	data, err := Render(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AppConfig
+	if _, err := toml.Decode(string(data), &got); err != nil {
+		t.Fatalf("rendered config does not parse: %v\n%s", err, data)
+	}
+
+	want := cfg
+	want.SubDomainIPv4 = "�@"
+	for _, f := range []struct{ name, got, want string }{
+		{"DNSPOD_SECRET_ID", got.SecretID, want.SecretID},
+		{"DNSPOD_SECRET_KEY", got.SecretKey, want.SecretKey},
+		{"DNSPOD_DOMAIN", got.Domain, want.Domain},
+		{"DNSPOD_RECORDID_IPV4", got.RecordIDIPv4, want.RecordIDIPv4},
+		{"DNSPOD_SUBDOMAIN_IPV4", got.SubDomainIPv4, want.SubDomainIPv4},
+		{"DNSPOD_RECORDID_IPV6", got.RecordIDIPv6, want.RecordIDIPv6},
+		{"DNSPOD_SUBDOMAIN_IPV6", got.SubDomainIPv6, want.SubDomainIPv6},
+		{"UPDATE_INTERVAL", got.Interval, want.Interval},
+	} {
+		if f.got != f.want {
+			t.Errorf("%s = %q, want %q", f.name, f.got, f.want)
+		}
+	}
+	if got.TTL != want.TTL {
+		t.Errorf("DNSPOD_TTL = %d, want %d", got.TTL, want.TTL)
+	}
+}
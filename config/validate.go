@@ -0,0 +1,814 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ddns-dnspod/ipfetcher"
+	"ddns-dnspod/proxy"
+)
+
+// Status is the outcome of validating a single configuration field.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarning
+	StatusError
+)
+
+// String returns the label printed in check reports.
+func (s Status) String() string {
+	switch s {
+	case StatusWarning:
+		return "WARN"
+	case StatusError:
+		return "ERROR"
+	default:
+		return "OK"
+	}
+}
+
+// FieldReport describes the validation result of one configuration field.
+type FieldReport struct {
+	Field   string
+	Status  Status
+	Message string
+}
+
+// TTL limits accepted by DNSPod. Free plans reject anything below 600.
+const (
+	MinTTL         = 1
+	MaxTTL         = 604800
+	MinFreePlanTTL = 600
+)
+
+// MaxWeight is the upper limit for DNSPOD_WEIGHT_*.
+const MaxWeight = 100
+
+// Validate checks every field of the configuration and returns one report per field,
+// including fields that are valid, so callers can print a complete overview.
+func (c AppConfig) Validate() []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: field, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	reports = append(reports, c.validateCredentials()...)
+
+	if c.Domain == "" {
+		add("DNSPOD_DOMAIN", StatusError, "not set")
+	} else if err := validateDomain(c.Domain); err != nil {
+		add("DNSPOD_DOMAIN", StatusError, "%q is not a valid domain: %v", c.Domain, err)
+	} else {
+		add("DNSPOD_DOMAIN", StatusOK, "%s", c.Domain)
+	}
+
+	bothMissing := !c.HasRecords()
+	for _, rec := range []struct {
+		family, idField, subField, id, sub string
+	}{
+		{"IPv4", "DNSPOD_RECORDID_IPV4", "DNSPOD_SUBDOMAIN_IPV4", c.RecordIDIPv4, c.SubDomainIPv4},
+		{"IPv6", "DNSPOD_RECORDID_IPV6", "DNSPOD_SUBDOMAIN_IPV6", c.RecordIDIPv6, c.SubDomainIPv6},
+	} {
+		switch {
+		case rec.id == "" && bothMissing:
+			add(rec.idField, StatusError, "not set; at least one of DNSPOD_RECORDID_IPV4/DNSPOD_RECORDID_IPV6 or a [[record]] table is required")
+		case rec.id == "":
+			add(rec.idField, StatusWarning, "not set; %s updates will be skipped", rec.family)
+		default:
+			if _, err := ParseRecordID(rec.id); err != nil {
+				add(rec.idField, StatusError, "%v", err)
+			} else {
+				add(rec.idField, StatusOK, "%s", rec.id)
+			}
+		}
+
+		switch {
+		case rec.sub == "":
+			add(rec.subField, StatusOK, "not set, defaults to \"@\"")
+		default:
+			if err := validateSubDomain(rec.sub); err != nil {
+				add(rec.subField, StatusError, "%q is not a valid subdomain: %v", rec.sub, err)
+			} else {
+				add(rec.subField, StatusOK, "%s", rec.sub)
+			}
+		}
+	}
+
+	reports = append(reports, validateTTL("DNSPOD_TTL", c.TTL, "not set, keeps each record's current TTL"))
+	for _, rec := range []struct {
+		suffix, recordID, line string
+		ttl                    int64
+		weight                 *int64
+	}{
+		{"IPV4", c.RecordIDIPv4, c.LineIPv4, c.TTLIPv4, c.WeightIPv4},
+		{"IPV6", c.RecordIDIPv6, c.LineIPv6, c.TTLIPv6, c.WeightIPv6},
+	} {
+		if rec.recordID == "" {
+			continue
+		}
+		if rec.line == "" {
+			add("DNSPOD_LINE_"+rec.suffix, StatusOK, "not set, keeps the record's current line")
+		} else {
+			add("DNSPOD_LINE_"+rec.suffix, StatusOK, "%s", rec.line)
+		}
+		if rec.ttl != 0 {
+			reports = append(reports, validateTTL("DNSPOD_TTL_"+rec.suffix, rec.ttl, ""))
+		}
+		if rec.weight != nil {
+			if *rec.weight < 0 || *rec.weight > MaxWeight {
+				add("DNSPOD_WEIGHT_"+rec.suffix, StatusError, "%d is outside the range 0-%d", *rec.weight, MaxWeight)
+			} else {
+				add("DNSPOD_WEIGHT_"+rec.suffix, StatusOK, "%d", *rec.weight)
+			}
+		}
+	}
+
+	if c.Interval == "" {
+		add("UPDATE_INTERVAL", StatusOK, "not set, defaults to %s", DefaultInterval)
+	} else if d, err := c.UpdateInterval(); err != nil {
+		add("UPDATE_INTERVAL", StatusError, "%v", err)
+	} else {
+		add("UPDATE_INTERVAL", StatusOK, "%s", d)
+	}
+
+	if c.StateFile == "" {
+		add("STATE_FILE", StatusOK, "not set, saved next to the executable")
+	} else if info, err := os.Stat(filepath.Dir(c.StateFile)); err != nil || !info.IsDir() {
+		add("STATE_FILE", StatusError, "directory of %s does not exist", c.StateFile)
+	} else {
+		add("STATE_FILE", StatusOK, "%s", c.StateFile)
+	}
+
+	names := map[string]bool{}
+	for i, src := range c.NamedSources {
+		reports = append(reports, src.validate(i)...)
+		if src.Name != "" && names[src.Name] {
+			add(fmt.Sprintf("ip_source[%d].name", i), StatusError, "%q is used by more than one [[ip_source]]", src.Name)
+		}
+		names[src.Name] = true
+	}
+	for i, rec := range c.Records {
+		reports = append(reports, rec.validate(i, c)...)
+	}
+	reports = append(reports, c.Proxy.validate()...)
+	reports = append(reports, c.Log.validate()...)
+
+	for _, src := range []struct {
+		field   string
+		entries []string
+		family  string
+	}{
+		{"IP_SOURCES_IPV4", c.IPSourcesIPv4, "ipv4"},
+		{"IP_SOURCES_IPV6", c.IPSourcesIPv6, "ipv6"},
+	} {
+		if len(src.entries) == 0 {
+			add(src.field, StatusOK, "not set, using the built-in source")
+			continue
+		}
+		for i, raw := range src.entries {
+			field := fmt.Sprintf("%s[%d]", src.field, i)
+			if err := c.validateSourceEntry(raw, src.family); err != nil {
+				add(field, StatusError, "%q: %v", raw, err)
+			} else {
+				add(field, StatusOK, "%s", raw)
+			}
+		}
+	}
+
+	return reports
+}
+
+// HasErrors reports whether any of the reports has StatusError.
+func HasErrors(reports []FieldReport) bool {
+	for _, r := range reports {
+		if r.Status == StatusError {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRecordID converts a record ID from its string form, as stored in AppConfig.
+func ParseRecordID(id string) (int64, error) {
+	v, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("record ID %q must be a positive integer", id)
+	}
+	return v, nil
+}
+
+func validateDomain(domain string) error {
+	domain = strings.TrimSuffix(domain, ".")
+	if len(domain) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("must contain at least one dot, e.g. example.com")
+	}
+	for _, label := range labels {
+		if err := validateLabel(label, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSubDomain(sub string) error {
+	if sub == "@" {
+		return nil
+	}
+	if strings.HasSuffix(sub, ".") {
+		return fmt.Errorf("must not end with a dot; use the host part only, e.g. \"www\"")
+	}
+	for i, label := range strings.Split(sub, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+		if err := validateLabel(label, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateLabel checks a single DNS label. Underscores are only accepted in
+// subdomains, where DNSPod allows them for names such as _dmarc.
+func validateLabel(label string, allowUnderscore bool) error {
+	if label == "" {
+		return fmt.Errorf("contains an empty label")
+	}
+	if len(label) > 63 {
+		return fmt.Errorf("label %q is longer than 63 characters", label)
+	}
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return fmt.Errorf("label %q must not start or end with a hyphen", label)
+	}
+	for _, r := range label {
+		switch {
+		case r == '-', unicode.IsLetter(r), unicode.IsDigit(r):
+		case r == '_' && allowUnderscore:
+		default:
+			return fmt.Errorf("label %q contains invalid character %q", label, r)
+		}
+	}
+	return nil
+}
+
+func (r RecordConfig) validate(index int, c AppConfig) []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: fmt.Sprintf("record[%d].%s", index, field), Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.RecordID <= 0 {
+		add("record_id", StatusError, "must be a positive record ID")
+	} else {
+		add("record_id", StatusOK, "%d", r.RecordID)
+	}
+	if r.SubDomain != "" {
+		if err := validateSubDomain(r.SubDomain); err != nil {
+			add("sub_domain", StatusError, "%q is not a valid subdomain: %v", r.SubDomain, err)
+		}
+	}
+	switch r.RecordType() {
+	case "A", "AAAA":
+	default:
+		add("type", StatusError, "%q must be A or AAAA", r.Type)
+	}
+	if r.Line == "" {
+		add("line", StatusWarning, "not set, keeps the record's current line; set it for split-horizon records")
+	} else {
+		add("line", StatusOK, "%s", r.Line)
+	}
+	if r.TTL != 0 {
+		report := validateTTL("ttl", r.TTL, "")
+		add("ttl", report.Status, "%s", report.Message)
+	}
+	if r.Weight != nil && (*r.Weight < 0 || *r.Weight > MaxWeight) {
+		add("weight", StatusError, "%d is outside the range 0-%d", *r.Weight, MaxWeight)
+	}
+
+	family := "ipv4"
+	if r.RecordType() == "AAAA" {
+		family = "ipv6"
+	}
+	for i, raw := range r.IPSources {
+		if err := c.validateSourceEntry(raw, family); err != nil {
+			add(fmt.Sprintf("ip_sources[%d]", i), StatusError, "%q: %v", raw, err)
+		}
+	}
+	validateBinding(add, r.Interface, r.SourceAddress, family)
+	return reports
+}
+
+func (s IPSourceConfig) validate(index int) []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: fmt.Sprintf("ip_source[%d].%s", index, field), Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case s.Name == "":
+		add("name", StatusError, "not set; IP_SOURCES_* and ip_sources refer to the source by name")
+	case strings.Contains(s.Name, "://"):
+		add("name", StatusError, "%q looks like a URL; use a short name such as \"wan1-v4\"", s.Name)
+	default:
+		add("name", StatusOK, "%s", s.Name)
+	}
+	family := strings.ToLower(s.Family)
+	switch family {
+	case "":
+		add("family", StatusOK, "not set, follows the list that uses the source")
+	case "ipv4", "ipv6":
+		add("family", StatusOK, "%s", family)
+	default:
+		add("family", StatusError, "%q must be ipv4 or ipv6", s.Family)
+		family = ""
+	}
+
+	switch s.SourceType() {
+	case "http":
+		if err := validateSourceURL(s.URL); err != nil {
+			add("url", StatusError, "%q: %v", s.URL, err)
+		} else {
+			add("url", StatusOK, "%s", s.URL)
+		}
+	case "dns":
+		if s.URL != "" {
+			add("url", StatusError, "not used by dns sources; set resolvers and query_name")
+		}
+		if len(s.Resolvers) == 0 {
+			add("resolvers", StatusError, "not set; list DNS servers such as \"208.67.222.222\"")
+		}
+		for i, resolver := range s.Resolvers {
+			if err := validateResolver(resolver); err != nil {
+				add(fmt.Sprintf("resolvers[%d]", i), StatusError, "%q: %v", resolver, err)
+			}
+		}
+		if s.QueryName == "" {
+			add("query_name", StatusError, "not set, e.g. myip.opendns.com")
+		} else if err := validateDomain(strings.TrimSuffix(s.QueryName, ".")); err != nil {
+			add("query_name", StatusError, "%q: %v", s.QueryName, err)
+		} else {
+			add("query_name", StatusOK, "%s", s.QueryName)
+		}
+		switch qtype := strings.ToUpper(s.QueryType); {
+		case qtype == "" || qtype == "TXT":
+		case qtype != "A" && qtype != "AAAA":
+			add("query_type", StatusError, "%q must be A, AAAA or TXT", s.QueryType)
+		case family == "ipv4" && qtype == "AAAA", family == "ipv6" && qtype == "A":
+			add("query_type", StatusError, "%s does not match family %s", qtype, family)
+		}
+	case "stun":
+		if s.URL != "" {
+			add("url", StatusError, "not used by stun sources; set servers")
+		}
+		if len(s.Servers) == 0 {
+			add("servers", StatusError, "not set; list STUN servers such as \"stun.l.google.com:19302\"")
+		}
+		for i, server := range s.Servers {
+			if err := validateResolver(server); err != nil {
+				add(fmt.Sprintf("servers[%d]", i), StatusError, "%q: %v", server, err)
+			} else {
+				add(fmt.Sprintf("servers[%d]", i), StatusOK, "%s", server)
+			}
+		}
+	case "upnp":
+		if s.URL != "" {
+			add("url", StatusError, "not used by upnp sources; set control_url to skip discovery")
+		}
+		if family == "ipv6" {
+			add("family", StatusError, "UPnP IGD only reports IPv4 addresses")
+		}
+		if s.ControlURL != "" {
+			if err := validateSourceURL(s.ControlURL); err != nil {
+				add("control_url", StatusError, "%q: %v", s.ControlURL, err)
+			} else {
+				add("control_url", StatusOK, "%s", s.ControlURL)
+			}
+		}
+		if s.SSDPAddress != "" {
+			if _, _, err := net.SplitHostPort(s.SSDPAddress); err != nil {
+				add("ssdp_address", StatusError, "%q must be host:port", s.SSDPAddress)
+			} else if validateResolver(s.SSDPAddress) != nil {
+				add("ssdp_address", StatusError, "%q is not a valid address", s.SSDPAddress)
+			}
+		}
+	case "natpmp", "pcp":
+		if s.URL != "" {
+			add("url", StatusError, "not used by %s sources; set gateway", s.SourceType())
+		}
+		if s.SourceType() == "natpmp" && family == "ipv6" {
+			add("family", StatusError, "NAT-PMP only reports IPv4 addresses; use pcp")
+		}
+		switch {
+		case s.Gateway != "":
+			if err := validateResolver(s.Gateway); err != nil {
+				add("gateway", StatusError, "%q: %v", s.Gateway, err)
+			} else {
+				add("gateway", StatusOK, "%s", s.Gateway)
+			}
+		case runtime.GOOS != "linux":
+			add("gateway", StatusError, "not set; the default gateway can only be found automatically on Linux")
+		default:
+			add("gateway", StatusOK, "not set, using the default gateway")
+		}
+	case "ubus", "page":
+		if err := validateSourceURL(s.URL); err != nil {
+			add("url", StatusError, "%q: %v", s.URL, err)
+		} else {
+			add("url", StatusOK, "%s", s.URL)
+		}
+		if s.SourceType() == "ubus" {
+			if s.Password == "" {
+				add("password", StatusError, "not set; ubus needs the router login")
+			}
+			if s.Regex != "" {
+				add("regex", StatusError, "not used by ubus sources; the answer is JSON, use json_path")
+			}
+			if len(s.Headers) > 0 {
+				add("headers", StatusError, "not used by ubus sources")
+			}
+		} else {
+			if s.JSONPath != "" && s.Regex != "" {
+				add("regex", StatusError, "set json_path or regex, not both")
+			}
+			if s.WANInterface != "" {
+				add("wan_interface", StatusError, "only used by ubus sources")
+			}
+			if s.Password != "" && s.Username == "" {
+				add("username", StatusError, "not set; password is sent with HTTP basic authentication")
+			}
+		}
+		if s.JSONPath != "" {
+			if err := ipfetcher.CheckJSONPath(s.JSONPath); err != nil {
+				add("json_path", StatusError, "%v", err)
+			} else {
+				add("json_path", StatusOK, "%s", s.JSONPath)
+			}
+		}
+		if s.Regex != "" {
+			if _, err := regexp.Compile(s.Regex); err != nil {
+				add("regex", StatusError, "%v", err)
+			} else {
+				add("regex", StatusOK, "%s", s.Regex)
+			}
+		}
+	case "command":
+		if s.URL != "" {
+			add("url", StatusError, "not used by command sources; set command")
+		}
+		if len(s.Command) == 0 || s.Command[0] == "" {
+			add("command", StatusError, "not set; list the program and its arguments, e.g. [\"/usr/local/bin/wan-ip\", \"eth1\"]")
+		} else if path, err := exec.LookPath(s.Command[0]); err != nil {
+			add("command", StatusWarning, "%s: %v (fine if this config is for another machine)", s.Command[0], err)
+		} else {
+			add("command", StatusOK, "%s", path)
+		}
+		if d, err := s.CommandTimeout(); err != nil {
+			add("timeout", StatusError, "%v", err)
+		} else {
+			add("timeout", StatusOK, "%s", d)
+		}
+	case "metadata":
+		provider := strings.ToLower(s.Provider)
+		if base, ok := ipfetcher.MetadataBaseURLs[provider]; !ok {
+			add("provider", StatusError, "%q must be tencent, aws or gcp", s.Provider)
+		} else if s.URL == "" {
+			add("provider", StatusOK, "%s (%s)", provider, base)
+		} else {
+			add("provider", StatusOK, "%s", provider)
+		}
+		if s.URL != "" {
+			if err := validateSourceURL(s.URL); err != nil {
+				add("url", StatusError, "%q: %v", s.URL, err)
+			} else {
+				add("url", StatusOK, "%s, instead of the provider's metadata endpoint", s.URL)
+			}
+		}
+	default:
+		add("type", StatusError, "%q must be http, dns, stun, upnp, natpmp, pcp, ubus, page, command or metadata", s.Type)
+	}
+	validateBinding(add, s.Interface, s.SourceAddress, family)
+	return reports
+}
+
+// validateSourceEntry checks an IP_SOURCES_* or ip_sources entry, which is
+// a URL, a stun:host[:port] URI, the name of an [[ip_source]] or a preset, used for family
+// ("ipv4" or "ipv6").
+func (c AppConfig) validateSourceEntry(raw, family string) error {
+	if src, ok := c.NamedSource(raw); ok {
+		if src.Family != "" && !strings.EqualFold(src.Family, family) {
+			return fmt.Errorf("[[ip_source]] %s is %s but is used for %s", raw, strings.ToLower(src.Family), family)
+		}
+		qtype := strings.ToUpper(src.QueryType)
+		if src.SourceType() == "dns" && (family == "ipv4" && qtype == "AAAA" || family == "ipv6" && qtype == "A") {
+			return fmt.Errorf("[[ip_source]] %s queries %s records but is used for %s", raw, qtype, family)
+		}
+		return checkIPv4Only(src.SourceType(), family)
+	}
+	if _, ok := ipfetcher.Preset(raw, ipfetcher.Binding{}); ok {
+		return checkIPv4Only(raw, family)
+	}
+	if server, ok := strings.CutPrefix(raw, "stun:"); ok {
+		return validateResolver(server)
+	}
+	if !strings.Contains(raw, "://") {
+		return fmt.Errorf("no [[ip_source]] or preset (%s) has this name", strings.Join(ipfetcher.Presets, ", "))
+	}
+	return validateSourceURL(raw)
+}
+
+// checkIPv4Only rejects router protocols that cannot report IPv6 addresses
+// when they are used for family.
+func checkIPv4Only(sourceType, family string) error {
+	if family == "ipv6" && (sourceType == ipfetcher.RouterUPnP || sourceType == ipfetcher.RouterNATPMP) {
+		return fmt.Errorf("%s only reports IPv4 addresses; use pcp for IPv6", sourceType)
+	}
+	return nil
+}
+
+// validateResolver checks a DNS or STUN server given as host or host:port.
+func validateResolver(resolver string) error {
+	host := resolver
+	if h, port, err := net.SplitHostPort(resolver); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		host = h
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return nil
+	}
+	return validateDomain(host)
+}
+
+// validateBinding checks the interface and source_address keys shared by
+// [[record]] and [[ip_source]]. family is "ipv4", "ipv6" or "" for either.
+func validateBinding(add func(field string, status Status, format string, args ...interface{}), iface, sourceAddress, family string) {
+	switch {
+	case iface != "" && sourceAddress != "":
+		add("interface", StatusError, "set either interface or source_address, not both")
+	case iface != "":
+		if _, err := net.InterfaceByName(iface); err != nil {
+			add("interface", StatusWarning, "%s: %v (fine if this config is for another machine)", iface, err)
+		} else if runtime.GOOS != "linux" {
+			add("interface", StatusOK, "%s (connects from its address; binding to the device needs Linux)", iface)
+		} else {
+			add("interface", StatusOK, "%s", iface)
+		}
+	case sourceAddress != "":
+		ip := net.ParseIP(sourceAddress)
+		switch {
+		case ip == nil:
+			add("source_address", StatusError, "%q is not an IP address", sourceAddress)
+		case family == "ipv4" && ip.To4() == nil, family == "ipv6" && ip.To4() != nil:
+			add("source_address", StatusError, "%s is not an %s address", ip, strings.Replace(family, "ip", "IP", 1))
+		default:
+			add("source_address", StatusOK, "%s", ip)
+		}
+	}
+}
+
+// validateTTL checks a TTL value; unsetMessage is reported for 0.
+func validateTTL(field string, ttl int64, unsetMessage string) FieldReport {
+	switch {
+	case ttl == 0:
+		return FieldReport{Field: field, Status: StatusOK, Message: unsetMessage}
+	case ttl < MinTTL || ttl > MaxTTL:
+		return FieldReport{Field: field, Status: StatusError, Message: fmt.Sprintf("%d is outside the range %d-%d", ttl, MinTTL, MaxTTL)}
+	case ttl < MinFreePlanTTL:
+		return FieldReport{Field: field, Status: StatusWarning, Message: fmt.Sprintf("%d is below %d, which the DNSPod free plan rejects", ttl, MinFreePlanTTL)}
+	default:
+		return FieldReport{Field: field, Status: StatusOK, Message: fmt.Sprintf("%d", ttl)}
+	}
+}
+
+func validateSourceURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	return nil
+}
+
+func (c AppConfig) validateCredentials() []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: field, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch c.CredentialSource {
+	case "", "static":
+		add("CREDENTIAL_SOURCE", StatusOK, "static keys")
+	case "cvm_role":
+		add("CREDENTIAL_SOURCE", StatusOK, "CVM role %s", valueOr(c.CVMRoleName, "bound to this instance"))
+		if c.MetadataURL != "" {
+			if err := validateSourceURL(c.MetadataURL); err != nil {
+				add("METADATA_URL", StatusError, "%v", err)
+			} else {
+				add("METADATA_URL", StatusOK, "%s", c.MetadataURL)
+			}
+		}
+	case "sts":
+		if c.STSRoleArn == "" {
+			add("STS_ROLE_ARN", StatusError, "required with CREDENTIAL_SOURCE = \"sts\"")
+		} else if !strings.HasPrefix(c.STSRoleArn, "qcs::cam::") {
+			add("STS_ROLE_ARN", StatusWarning, "%q does not look like qcs::cam::uin/<uin>:roleName/<name>", c.STSRoleArn)
+		} else {
+			add("STS_ROLE_ARN", StatusOK, "%s", c.STSRoleArn)
+		}
+		if _, err := c.STSSessionDuration(); err != nil {
+			add("STS_DURATION", StatusError, "%v", err)
+		}
+	case "chain":
+		add("CREDENTIAL_SOURCE", StatusOK, "SDK provider chain: TENCENTCLOUD_SECRET_ID/KEY, ~/.tencentcloud/credentials, CVM role")
+	default:
+		add("CREDENTIAL_SOURCE", StatusError, "%q must be static, cvm_role, sts or chain", c.CredentialSource)
+	}
+
+	if !c.NeedsSecretKeys() {
+		if c.SecretID != "" || c.SecretKey != "" {
+			add("DNSPOD_SECRET_KEY", StatusWarning, "set but not used with CREDENTIAL_SOURCE = %q", c.CredentialSource)
+		}
+		return reports
+	}
+
+	switch {
+	case c.SecretID == "":
+		add("DNSPOD_SECRET_ID", StatusError, "not set")
+	case !strings.HasPrefix(c.SecretID, "AKID"):
+		add("DNSPOD_SECRET_ID", StatusWarning, "does not start with \"AKID\"; make sure this is a Tencent Cloud SecretId")
+	default:
+		add("DNSPOD_SECRET_ID", StatusOK, "set")
+	}
+
+	switch {
+	case c.SecretKey == "":
+		add("DNSPOD_SECRET_KEY", StatusError, "not set")
+	case len(c.SecretKey) != 32:
+		add("DNSPOD_SECRET_KEY", StatusWarning, "is %d characters long, Tencent Cloud SecretKeys are usually 32", len(c.SecretKey))
+	default:
+		add("DNSPOD_SECRET_KEY", StatusOK, "set")
+	}
+	return reports
+}
+
+func (p ProxiesConfig) validate() []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: field, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, c := range []struct {
+		table string
+		cfg   ProxyConfig
+	}{
+		{"proxy.api", p.API},
+		{"proxy.ip_detection", p.IPDetection},
+	} {
+		u, err := proxy.Parse(c.cfg.URL)
+		switch {
+		case err != nil:
+			add(c.table+".url", StatusError, "%v", err)
+		case c.cfg.URL == "":
+			if c.table == "proxy.ip_detection" && (os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "") {
+				add(c.table+".url", StatusWarning, "not set, so HTTPS_PROXY from the environment applies and lookups may report the proxy's address; set \"direct\" to bypass it")
+			} else {
+				add(c.table+".url", StatusOK, "not set, HTTP_PROXY/HTTPS_PROXY from the environment apply")
+			}
+		case u == nil:
+			add(c.table+".url", StatusOK, "direct, environment proxies are ignored")
+		case c.table == "proxy.ip_detection":
+			add(c.table+".url", StatusWarning, "%s; lookups report the proxy's public address unless the proxy exits over the same uplink", u.Redacted())
+		default:
+			add(c.table+".url", StatusOK, "%s", u.Redacted())
+		}
+		for i, entry := range c.cfg.NoProxy {
+			if err := proxy.CheckNoProxy(entry); err != nil {
+				add(fmt.Sprintf("%s.no_proxy[%d]", c.table, i), StatusError, "%v", err)
+			}
+		}
+	}
+	return reports
+}
+
+func (l LogConfig) validate() []FieldReport {
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: "log." + field, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// logrus and the log options accept any case, so match them here.
+	switch strings.ToLower(l.Level) {
+	case "":
+		add("level", StatusOK, "not set, defaults to info")
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+		add("level", StatusOK, "%s", l.Level)
+	default:
+		add("level", StatusError, "%q is not one of trace, debug, info, warn, error", l.Level)
+	}
+
+	switch strings.ToLower(l.Format) {
+	case "", "text", "json":
+		add("format", StatusOK, "%s", valueOr(l.Format, "text"))
+	default:
+		add("format", StatusError, "%q must be text or json", l.Format)
+	}
+
+	switch {
+	case l.DisableFile:
+		add("file", StatusOK, "file output disabled")
+	case l.File != "" && l.Dir != "":
+		add("file", StatusWarning, "both file and dir are set; dir is ignored")
+	case l.File != "":
+		add("file", StatusOK, "%s", l.File)
+	case l.Dir != "":
+		add("dir", StatusOK, "%s", l.Dir)
+	default:
+		add("file", StatusOK, "not set, next to the executable or in the platform log directory")
+	}
+
+	if l.MaxSizeMB < 0 || l.MaxBackups < 0 || l.MaxAgeDays < 0 {
+		add("rotation", StatusError, "max_size_mb, max_backups and max_age_days must not be negative")
+	}
+
+	if l.Journald {
+		if runtime.GOOS == "linux" {
+			add("journald", StatusOK, "enabled")
+		} else {
+			add("journald", StatusError, "journald is only available on Linux")
+		}
+	}
+	reports = append(reports, l.Syslog.validate()...)
+	return reports
+}
+
+func (s SyslogConfig) validate() []FieldReport {
+	if s.URL == "" {
+		return nil
+	}
+	var reports []FieldReport
+	add := func(field string, status Status, format string, args ...interface{}) {
+		reports = append(reports, FieldReport{Field: "log.syslog." + field, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+
+	u, err := url.Parse(s.URL)
+	switch {
+	case err != nil:
+		add("url", StatusError, "invalid URL: %v", err)
+	case u.Scheme == "unix" && u.Path != "":
+		add("url", StatusOK, "%s", s.URL)
+	case u.Scheme == "udp" || u.Scheme == "tcp" || u.Scheme == "tls":
+		if _, port, splitErr := net.SplitHostPort(u.Host); splitErr != nil || port == "" {
+			add("url", StatusError, "%q must include host and port, e.g. tls://logs.example.com:6514", s.URL)
+		} else if u.Scheme == "udp" {
+			add("url", StatusWarning, "%s: UDP may silently drop messages, prefer tcp:// or tls://", s.URL)
+		} else {
+			add("url", StatusOK, "%s", s.URL)
+		}
+	default:
+		add("url", StatusError, "%q: scheme must be udp, tcp, tls or unix", s.URL)
+	}
+
+	switch strings.ToLower(s.Facility) {
+	case "", "kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7":
+		add("facility", StatusOK, "%s", valueOr(s.Facility, "daemon"))
+	default:
+		add("facility", StatusError, "unknown facility %q", s.Facility)
+	}
+
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		add("cert_file", StatusError, "cert_file and key_file must be set together")
+	}
+	if s.InsecureSkipVerify {
+		add("insecure_skip_verify", StatusWarning, "the syslog server certificate is not verified")
+	}
+	return reports
+}
+
+func valueOr(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
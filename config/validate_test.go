@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg   LogConfig
+		field string
+		want  Status
+	}{
+		{LogConfig{Format: "json"}, "log.format", StatusOK},
+		{LogConfig{Format: "JSON"}, "log.format", StatusOK},
+		{LogConfig{Format: "Text"}, "log.format", StatusOK},
+		{LogConfig{Format: "xml"}, "log.format", StatusError},
+		{LogConfig{Level: "Debug"}, "log.level", StatusOK},
+		{LogConfig{Level: "verbose"}, "log.level", StatusError},
+	}
+	for _, tt := range tests {
+		var got *FieldReport
+		reports := tt.cfg.validate()
+		for i := range reports {
+			if reports[i].Field == tt.field {
+				got = &reports[i]
+			}
+		}
+		if got == nil {
+			t.Errorf("%+v: no report for %s", tt.cfg, tt.field)
+			continue
+		}
+		if got.Status != tt.want {
+			t.Errorf("%+v: %s status = %v (%s), want %v", tt.cfg, tt.field, got.Status, got.Message, tt.want)
+		}
+	}
+}
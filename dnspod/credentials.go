@@ -0,0 +1,290 @@
+package dnspod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ddns-dnspod/logger"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+// Credential sources for CredentialOptions.Source.
+const (
+	CredentialStatic  = "static"   // SecretID/SecretKey from the config
+	CredentialCVMRole = "cvm_role" // Temporary keys of the role bound to this CVM
+	CredentialSTS     = "sts"      // STS AssumeRole using SecretID/SecretKey
+	CredentialChain   = "chain"    // SDK provider chain: TENCENTCLOUD_* env, ~/.tencentcloud/credentials, CVM role
+)
+
+// DefaultMetadataURL is the Tencent Cloud CVM metadata service.
+const DefaultMetadataURL = "http://metadata.tencentyun.com/latest/meta-data"
+
+// DefaultSTSDuration is the lifetime requested for AssumeRole credentials.
+const DefaultSTSDuration = 2 * time.Hour
+
+// credentialRefreshMargin is how long before expiry temporary keys are renewed,
+// so a request never starts with keys about to expire.
+const credentialRefreshMargin = 5 * time.Minute
+
+// CredentialOptions selects where API credentials come from.
+type CredentialOptions struct {
+	Source    string // One of the Credential* constants; empty means CredentialStatic
+	SecretID  string
+	SecretKey string
+
+	RoleName    string // CVM role; empty means the role bound to the instance
+	MetadataURL string // Empty means DefaultMetadataURL
+
+	RoleArn     string // STS role to assume
+	SessionName string
+	Duration    time.Duration // Empty means DefaultSTSDuration
+}
+
+// activeCredential is used by newClient instead of the static keys passed by
+// callers. It is nil for CredentialStatic.
+var (
+	credentialMu     sync.Mutex
+	activeCredential common.CredentialIface
+)
+
+// UseCredentials configures the credentials every later API call uses and
+// fetches temporary keys once, so a misconfigured role is reported right away.
+func UseCredentials(opts CredentialOptions) error {
+	var cred common.CredentialIface
+	switch opts.Source {
+	case "", CredentialStatic:
+	case CredentialCVMRole:
+		c := &refreshingCredential{fetch: func() (tempKeys, error) { return fetchCVMRoleKeys(opts.MetadataURL, opts.RoleName) }}
+		if err := c.refresh(); err != nil {
+			return fmt.Errorf("failed to get CVM role credentials: %w", err)
+		}
+		cred = c
+	case CredentialSTS:
+		c := &refreshingCredential{fetch: func() (tempKeys, error) { return assumeRole(opts) }}
+		if err := c.refresh(); err != nil {
+			return fmt.Errorf("STS AssumeRole failed: %w", err)
+		}
+		cred = c
+	case CredentialChain:
+		// Credentials from the chain refresh themselves when they come from a CVM role.
+		c, err := common.DefaultProviderChain().GetCredential()
+		if err != nil {
+			return fmt.Errorf("no credentials found in the provider chain: %w", err)
+		}
+		logger.AddSecrets(c.GetSecretKey(), c.GetToken())
+		cred = c
+	default:
+		return fmt.Errorf("unknown credential source %q", opts.Source)
+	}
+
+	credentialMu.Lock()
+	activeCredential = cred
+	credentialMu.Unlock()
+	return nil
+}
+
+// HasCredentials reports whether API calls can be signed: either temporary
+// credentials are configured or cfg carries static keys.
+func (cfg UpdateConfig) HasCredentials() bool {
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	return activeCredential != nil || (cfg.SecretID != "" && cfg.SecretKey != "")
+}
+
+// credential returns the credential for a new client.
+func credential(secretID, secretKey string) (common.CredentialIface, error) {
+	credentialMu.Lock()
+	cred := activeCredential
+	credentialMu.Unlock()
+
+	if c, ok := cred.(*refreshingCredential); ok {
+		if err := c.ensureFresh(); err != nil {
+			return nil, err
+		}
+		return c.snapshot(), nil
+	}
+	if cred != nil {
+		return cred, nil
+	}
+	return common.NewCredential(secretID, secretKey), nil
+}
+
+// tempKeys is one set of temporary credentials.
+type tempKeys struct {
+	SecretID  string
+	SecretKey string
+	Token     string
+	Expires   time.Time
+}
+
+// refreshingCredential holds temporary keys and renews them shortly before
+// they expire. If renewal fails, the old keys are used while still valid.
+type refreshingCredential struct {
+	refreshMu sync.Mutex // Held while fetching, so concurrent calls renew once
+	mu        sync.Mutex // Guards keys
+	keys      tempKeys
+	fetch     func() (tempKeys, error)
+}
+
+func (c *refreshingCredential) refresh() error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refreshLocked()
+}
+
+// refreshLocked fetches new keys; the caller holds refreshMu.
+func (c *refreshingCredential) refreshLocked() error {
+	keys, err := c.fetch()
+	if err != nil {
+		return err
+	}
+	logger.AddSecrets(keys.SecretKey, keys.Token)
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *refreshingCredential) expires() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys.Expires
+}
+
+func (c *refreshingCredential) ensureFresh() error {
+	if time.Until(c.expires()) > credentialRefreshMargin {
+		return nil
+	}
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	// Another call may have renewed the keys while this one waited.
+	expires := c.expires()
+	if time.Until(expires) > credentialRefreshMargin {
+		return nil
+	}
+	if err := c.refreshLocked(); err != nil {
+		if time.Until(expires) > 0 {
+			logger.L().Warnf("Failed to renew temporary credentials, using the current ones until %s: %v", expires.Format(time.RFC3339), err)
+			return nil
+		}
+		return fmt.Errorf("temporary credentials expired and could not be renewed: %w", err)
+	}
+	return nil
+}
+
+// snapshot returns the current keys as a plain credential, so one API call
+// always signs with a consistent SecretId/SecretKey/Token triple.
+func (c *refreshingCredential) snapshot() *common.Credential {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return common.NewTokenCredential(c.keys.SecretID, c.keys.SecretKey, c.keys.Token)
+}
+
+// GetSecretId implements common.CredentialIface.
+func (c *refreshingCredential) GetSecretId() string { return c.snapshot().SecretId }
+
+// GetSecretKey implements common.CredentialIface.
+func (c *refreshingCredential) GetSecretKey() string { return c.snapshot().SecretKey }
+
+// GetToken implements common.CredentialIface.
+func (c *refreshingCredential) GetToken() string { return c.snapshot().Token }
+
+// GetCredential implements common.CredentialIface.
+func (c *refreshingCredential) GetCredential() (string, string, string) {
+	s := c.snapshot()
+	return s.SecretId, s.SecretKey, s.Token
+}
+
+var metadataClient = &http.Client{Timeout: 5 * time.Second}
+
+// fetchCVMRoleKeys reads the role's temporary keys from the metadata service.
+// See https://cloud.tencent.com/document/product/213/4934
+func fetchCVMRoleKeys(metadataURL, roleName string) (tempKeys, error) {
+	base := strings.TrimRight(metadataURL, "/")
+	if base == "" {
+		base = DefaultMetadataURL
+	}
+	rolesURL := base + "/cam/security-credentials/"
+
+	if roleName == "" {
+		body, err := metadataGet(rolesURL)
+		if err != nil {
+			return tempKeys{}, err
+		}
+		roleName, _, _ = strings.Cut(strings.TrimSpace(string(body)), "\n")
+		if roleName == "" {
+			return tempKeys{}, errors.New("no CAM role is bound to this instance")
+		}
+	}
+
+	body, err := metadataGet(rolesURL + roleName)
+	if err != nil {
+		return tempKeys{}, err
+	}
+	var rsp struct {
+		TmpSecretId  string
+		TmpSecretKey string
+		Token        string
+		ExpiredTime  int64
+		Code         string
+	}
+	if err := json.Unmarshal(body, &rsp); err != nil {
+		return tempKeys{}, fmt.Errorf("unexpected response for role %s: %w", roleName, err)
+	}
+	if rsp.Code != "Success" {
+		return tempKeys{}, fmt.Errorf("metadata service returned code %q for role %s", rsp.Code, roleName)
+	}
+	return tempKeys{
+		SecretID:  rsp.TmpSecretId,
+		SecretKey: rsp.TmpSecretKey,
+		Token:     rsp.Token,
+		Expires:   time.Unix(rsp.ExpiredTime, 0),
+	}, nil
+}
+
+func metadataGet(url string) ([]byte, error) {
+	resp, err := metadataClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s not found; is a CAM role bound to this instance?", url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// assumeRole obtains temporary keys for opts.RoleArn with the SDK's STS provider.
+func assumeRole(opts CredentialOptions) (tempKeys, error) {
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = DefaultSTSDuration
+	}
+	sessionName := opts.SessionName
+	if sessionName == "" {
+		sessionName = "ddns-dnspod"
+	}
+
+	requested := time.Now()
+	provider := common.NewRoleArnProvider(opts.SecretID, opts.SecretKey, opts.RoleArn, sessionName, int64(duration/time.Second))
+	cred, err := provider.GetCredential()
+	if err != nil {
+		return tempKeys{}, err
+	}
+	id, key, token := cred.GetCredential()
+	return tempKeys{SecretID: id, SecretKey: key, Token: token, Expires: requested.Add(duration)}, nil
+}
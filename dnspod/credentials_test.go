@@ -0,0 +1,179 @@
+package dnspod
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCVMMetadata serves the CAM role endpoints of the CVM metadata service.
+// keys is called for each request for the role's keys.
+func fakeCVMMetadata(t *testing.T, roles string, keys func(n int) (int, string)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/meta-data/cam/security-credentials/":
+			if roles == "" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, roles)
+		case "/meta-data/cam/security-credentials/ddns":
+			status, body := keys(int(requests.Add(1)))
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func roleKeys(id string, expires time.Time) string {
+	return fmt.Sprintf(`{"TmpSecretId":%q,"TmpSecretKey":"key-%s","Token":"token-%s","ExpiredTime":%d,"Expiration":%q,"Code":"Success"}`,
+		id, id, id, expires.Unix(), expires.UTC().Format(time.RFC3339))
+}
+
+func TestFetchCVMRoleKeys(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name     string
+		roles    string // Listing of bound roles; empty answers 404
+		roleName string
+		status   int
+		body     string
+		wantErr  string
+	}{
+		{name: "discovered role", roles: "ddns\n", status: 200, body: roleKeys("AKID1", expires)},
+		{name: "configured role", roleName: "ddns", status: 200, body: roleKeys("AKID1", expires)},
+		{name: "no role bound", wantErr: "is a CAM role bound to this instance?"},
+		{name: "empty role list", roles: "\n", wantErr: "no CAM role is bound to this instance"},
+		{name: "unknown role", roleName: "other", wantErr: "not found"},
+		{name: "server error", roleName: "ddns", status: 500, body: "oops", wantErr: "returned HTTP 500"},
+		{name: "failure code", roleName: "ddns", status: 200, body: `{"Code":"Failed"}`, wantErr: `returned code "Failed" for role ddns`},
+		{name: "malformed response", roleName: "ddns", status: 200, body: "<html>", wantErr: "unexpected response for role ddns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := fakeCVMMetadata(t, tt.roles, func(int) (int, string) { return tt.status, tt.body })
+			keys, err := fetchCVMRoleKeys(srv.URL+"/meta-data/", tt.roleName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tempKeys{SecretID: "AKID1", SecretKey: "key-AKID1", Token: "token-AKID1", Expires: expires}
+			if keys != want {
+				t.Errorf("keys = %+v, want %+v", keys, want)
+			}
+		})
+	}
+}
+
+func useCVMRole(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	t.Cleanup(func() {
+		credentialMu.Lock()
+		activeCredential = nil
+		credentialMu.Unlock()
+	})
+	err := UseCredentials(CredentialOptions{Source: CredentialCVMRole, RoleName: "ddns", MetadataURL: srv.URL + "/meta-data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCVMRoleCredentialRefreshesBeforeExpiry(t *testing.T) {
+	srv, requests := fakeCVMMetadata(t, "", func(n int) (int, string) {
+		if n == 1 {
+			// Inside the refresh margin, so the first API call renews.
+			return 200, roleKeys("AKID1", time.Now().Add(credentialRefreshMargin/2))
+		}
+		return 200, roleKeys(fmt.Sprintf("AKID%d", n), time.Now().Add(time.Hour))
+	})
+	useCVMRole(t, srv)
+
+	var wg sync.WaitGroup
+	ids := make([]string, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cred, err := credential("", "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = cred.GetSecretId()
+		}()
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("metadata service was asked %d times, want 2 (one renewal for all callers)", n)
+	}
+	for _, id := range ids {
+		if id != "AKID2" {
+			t.Errorf("signed with %s, want the renewed AKID2", id)
+		}
+	}
+}
+
+func TestCVMRoleCredentialRenewalFailure(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		expires time.Duration // Lifetime of the first keys
+		wantErr string
+	}{
+		{name: "keys still valid", expires: credentialRefreshMargin / 2},
+		{name: "keys expired", expires: -time.Minute, wantErr: "temporary credentials expired and could not be renewed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := fakeCVMMetadata(t, "", func(n int) (int, string) {
+				if n == 1 {
+					return 200, roleKeys("AKID1", time.Now().Add(tt.expires))
+				}
+				return 500, "unavailable"
+			})
+			useCVMRole(t, srv)
+
+			cred, err := credential("", "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id := cred.GetSecretId(); id != "AKID1" {
+				t.Errorf("signed with %s, want the current AKID1", id)
+			}
+		})
+	}
+}
+
+func TestUseCredentialsReportsCVMRoleErrors(t *testing.T) {
+	srv, _ := fakeCVMMetadata(t, "", nil)
+	err := UseCredentials(CredentialOptions{Source: CredentialCVMRole, MetadataURL: srv.URL + "/meta-data"})
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to get CVM role credentials") {
+		t.Fatalf("error = %v", err)
+	}
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	if activeCredential != nil {
+		t.Error("a failed UseCredentials must not replace the active credential")
+	}
+}
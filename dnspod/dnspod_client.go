@@ -2,6 +2,9 @@ package dnspod
 
 import (
 	"ddns-dnspod/ipfetcher" // Assuming module path allows this
+	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -11,23 +14,92 @@ import (
 	dnspodapi "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323" // Alias to avoid conflict
 )
 
-// ModifyRecord updates a DNS record on DNSPod using the specific SDK.
-func ModifyRecord(domain string, recordId int64, value string, secretID string, secretKey string, recordType string, subDomain string, logger *logrus.Logger) {
-	credential := common.NewCredential(secretID, secretKey)
+// DefaultTTL is the TTL used for new records, and for existing ones when
+// DNSPod reports none.
+const DefaultTTL = 600
+
+// defaultRecordLine is the DNSPod line used for new records.
+const defaultRecordLine = "默认"
+
+// UpdateConfig holds the settings used by UpdateAndModifyRecords for one update cycle.
+type UpdateConfig struct {
+	SecretID      string
+	SecretKey     string
+	Domain        string
+	RecordIDIPv4  int64
+	RecordIDIPv6  int64
+	SubDomainIPv4 string
+	SubDomainIPv6 string
+	IPv4Options   RecordOptions // Line, TTL etc. for the A record; unset fields keep the live values
+	IPv6Options   RecordOptions
+	IPv4Sources   []ipfetcher.Source // Empty means ipfetcher.IPv4URL
+	IPv6Sources   []ipfetcher.Source // Empty means ipfetcher.IPv6URL
+	Records       []RecordConfig     // Additional records, e.g. one per ISP line
+	DryRun        bool               // Log intended changes instead of sending them
+}
+
+// RecordConfig is an additional record updated every cycle with an address
+// from its own sources. Multi-WAN sites use one per ISP line, with sources
+// bound to that carrier's uplink.
+type RecordConfig struct {
+	RecordID  int64
+	SubDomain string
+	Type      string // A or AAAA
+	Options   RecordOptions
+	Sources   []ipfetcher.Source // Empty means the built-in source for Type
+}
+
+// newClient creates a DNSPod API client. secretID and secretKey are used
+// unless UseCredentials configured temporary credentials.
+func newClient(secretID, secretKey string) (*dnspodapi.Client, error) {
+	credential, err := credential(secretID, secretKey)
+	if err != nil {
+		return nil, err
+	}
 	cpf := profile.NewClientProfile()
 	cpf.HttpProfile.Endpoint = "dnspod.tencentcloudapi.com"
+	return dnspodapi.NewClient(credential, "", cpf)
+}
 
-	client, errClient := dnspodapi.NewClient(credential, "", cpf)
+// UseProxy sets the proxy for all later API calls, in the form of
+// http.Transport.Proxy; nil means no proxy. It goes through the SDK's
+// DefaultHttpClient, so it also covers the client behind STS AssumeRole.
+func UseProxy(proxy func(*http.Request) (*url.URL, error)) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	common.DefaultHttpClient = &http.Client{Transport: transport}
+}
+
+// ModifyRecord sets the value of a DNS record on DNSPod. The record is read
+// first so that settings not given in opts keep their current values, and
+// it is not written when it already matches.
+// Errors are logged and also returned so callers can record the outcome.
+func ModifyRecord(domain string, recordId int64, value string, secretID string, secretKey string, recordType string, subDomain string, opts RecordOptions, logger *logrus.Logger) error {
+	live, err := DescribeRecord(secretID, secretKey, domain, recordId)
+	if err != nil {
+		logger.Errorf("Failed to read record %d before modifying it: %v", recordId, err)
+		return err
+	}
+	plan, changed := planModify(live, value, recordType, subDomain, opts)
+	if !changed {
+		logger.Infof("Record %d (%s %s) is already up to date: %s, %s", recordId, domain, recordType, value, plan)
+		return nil
+	}
+
+	client, errClient := newClient(secretID, secretKey)
 	if errClient != nil {
 		logger.Errorf("Failed to create DNSPod client: %v", errClient)
-		return
+		return fmt.Errorf("failed to create DNSPod client: %w", errClient)
 	}
 
 	request := dnspodapi.NewModifyRecordRequest()
 
 	request.Domain = common.StringPtr(domain)
 	request.RecordType = common.StringPtr(recordType)
-	request.RecordLine = common.StringPtr("默认")
+	request.RecordLine = common.StringPtr(plan.Line)
+	if plan.LineID != "" {
+		request.RecordLineId = common.StringPtr(plan.LineID)
+	}
 	request.Value = common.StringPtr(value)
 	request.RecordId = common.Uint64Ptr(uint64(recordId)) // Convert int64 to uint64
 
@@ -37,55 +109,106 @@ func ModifyRecord(domain string, recordId int64, value string, secretID string,
 		actualSubDomain = "@"
 	}
 	request.SubDomain = common.StringPtr(actualSubDomain)
+	request.TTL = common.Uint64Ptr(plan.TTL)
+	request.Weight = plan.Weight
+	request.MX = plan.MX
+	request.Remark = common.StringPtr(plan.Remark)
+	if plan.Status != "" {
+		request.Status = common.StringPtr(plan.Status)
+	}
 
-	request.TTL = common.Uint64Ptr(600) // Default TTL
-
-	logger.Debugf("Modifying DNSPod record: Domain=%s, Type=%s, Line=%s, Value=%s, RecordID=%d, SubDomain=%s, TTL=%d",
-		*request.Domain, *request.RecordType, *request.RecordLine, *request.Value, *request.RecordId, *request.SubDomain, *request.TTL)
+	logger.Debugf("Modifying DNSPod record: Domain=%s, Type=%s, Value=%s, RecordID=%d, SubDomain=%s, %s",
+		*request.Domain, *request.RecordType, *request.Value, *request.RecordId, *request.SubDomain, plan)
 
 	response, err := client.ModifyRecord(request)
 	if sdkErr, ok := err.(*errors.TencentCloudSDKError); ok {
 		logger.Errorf("DNSPod API error occurred: Code=%s, Message=%s, RequestId=%s", sdkErr.GetCode(), sdkErr.GetMessage(), sdkErr.GetRequestId())
-		return
+		return apiError("ModifyRecord", err)
 	}
 	if err != nil {
 		logger.Errorf("Failed to invoke ModifyRecord API: %v", err)
-		return
+		return apiError("ModifyRecord", err)
 	}
 
 	responseBody := response.ToJsonString()
 	logger.Infof("ModifyRecord API Response for %s (%s): %s", domain, recordType, responseBody)
+	return nil
 }
 
-// UpdateAndModifyRecords fetches current IP addresses and updates DNS records.
-func UpdateAndModifyRecords(secretID, secretKey, domain string, recordIDIPv4, recordIDIPv6 int64, subDomainIPv4, subDomainIPv6 string, logger *logrus.Logger) {
-	// The 'domain' parameter here is expected to be the main domain (e.g., "example.com").
+// FamilyResult is the outcome of one update cycle for the A or AAAA record.
+type FamilyResult struct {
+	RecordType string
+	RecordID   int64 // 0 when the record is not configured
+	SubDomain  string
+	Line       string // Configured line; empty keeps the live one
+	IP         string
+	Published  bool // ModifyRecord succeeded; false in dry-run mode
+	Err        error
+}
 
-	logger.Info("Fetching current IPv4 address...")
-	ipv4, err := ipfetcher.GetCurrentIP(ipfetcher.IPv4URL, logger)
-	if err != nil {
-		logger.Errorf("Error getting IPv4 address: %v", err)
-	} else {
-		logger.Infof("Current IPv4 Address: %s", ipv4)
-		if recordIDIPv4 != 0 {
-			ModifyRecord(domain, recordIDIPv4, ipv4, secretID, secretKey, "A", subDomainIPv4, logger)
-		} else {
-			logger.Warn("RecordID for IPv4 is not set. Skipping A record update.")
+// UpdateResult is the outcome of one UpdateAndModifyRecords call.
+type UpdateResult struct {
+	IPv4    FamilyResult
+	IPv6    FamilyResult
+	Records []FamilyResult // In the order of UpdateConfig.Records
+}
+
+// UpdateAndModifyRecords fetches current IP addresses and updates DNS records.
+func UpdateAndModifyRecords(cfg UpdateConfig, logger *logrus.Logger) UpdateResult {
+	// cfg.Domain is expected to be the main domain (e.g., "example.com").
+	result := UpdateResult{
+		IPv4: updateFamily(cfg, "IPv4", "A", cfg.RecordIDIPv4, cfg.SubDomainIPv4, cfg.IPv4Options, sourcesOrDefault(cfg.IPv4Sources, ipfetcher.IPv4), logger),
+		IPv6: updateFamily(cfg, "IPv6", "AAAA", cfg.RecordIDIPv6, cfg.SubDomainIPv6, cfg.IPv6Options, sourcesOrDefault(cfg.IPv6Sources, ipfetcher.IPv6), logger),
+	}
+	for _, rec := range cfg.Records {
+		family := ipfetcher.IPv4
+		if rec.Type == "AAAA" {
+			family = ipfetcher.IPv6
 		}
+		name := fmt.Sprintf("%s (record %d)", family, rec.RecordID)
+		if rec.Options.Line != "" {
+			name = fmt.Sprintf("%s (record %d, line %s)", family, rec.RecordID, rec.Options.Line)
+		}
+		result.Records = append(result.Records,
+			updateFamily(cfg, name, rec.Type, rec.RecordID, rec.SubDomain, rec.Options, sourcesOrDefault(rec.Sources, family), logger))
 	}
+	return result
+}
 
-	logger.Info("Fetching current IPv6 address...")
-	ipv6, err := ipfetcher.GetCurrentIP(ipfetcher.IPv6URL, logger)
+func updateFamily(cfg UpdateConfig, family, recordType string, recordID int64, subDomain string, opts RecordOptions, sources []ipfetcher.Source, logger *logrus.Logger) FamilyResult {
+	result := FamilyResult{RecordType: recordType, RecordID: recordID, SubDomain: subDomain, Line: opts.Line}
+
+	logger.Infof("Fetching current %s address...", family)
+	ip, err := ipfetcher.GetCurrentIPFromSources(sources, logger)
 	if err != nil {
-		logger.Errorf("Error getting IPv6 address: %v", err)
-	} else {
-		logger.Infof("Current IPv6 Address: %s", ipv6)
-		if recordIDIPv6 != 0 {
-			ModifyRecord(domain, recordIDIPv6, ipv6, secretID, secretKey, "AAAA", subDomainIPv6, logger)
-		} else {
-			logger.Warn("RecordID for IPv6 is not set. Skipping AAAA record update.")
-		}
+		logger.Errorf("Error getting %s address: %v", family, err)
+		result.Err = err
+		return result
+	}
+	logger.Infof("Current %s Address: %s", family, ip)
+	result.IP = ip
+
+	switch {
+	case recordID == 0:
+		logger.Warnf("RecordID for %s is not set. Skipping %s record update.", family, recordType)
+	case cfg.DryRun:
+		logIntendedModify(cfg, recordID, ip, recordType, subDomain, opts, logger)
+	default:
+		result.Err = ModifyRecord(cfg.Domain, recordID, ip, cfg.SecretID, cfg.SecretKey, recordType, subDomain, opts, logger)
+		result.Published = result.Err == nil
+	}
+	return result
+}
+
+// sourcesOrDefault returns sources, or the built-in source for family when empty.
+func sourcesOrDefault(sources []ipfetcher.Source, family ipfetcher.Family) []ipfetcher.Source {
+	if len(sources) > 0 {
+		return sources
+	}
+	if family == ipfetcher.IPv6 {
+		return []ipfetcher.Source{ipfetcher.HTTPSource{URL: ipfetcher.IPv6URL, Binding: ipfetcher.Binding{Family: family}}}
 	}
+	return []ipfetcher.Source{ipfetcher.HTTPSource{URL: ipfetcher.IPv4URL, Binding: ipfetcher.Binding{Family: family}}}
 }
 
 // Helper to parse domain and subdomain, if needed in the future.
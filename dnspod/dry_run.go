@@ -0,0 +1,41 @@
+package dnspod
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// logIntendedModify reads the live record and logs the ModifyRecord request
+// UpdateAndModifyRecords would send, without sending it.
+func logIntendedModify(cfg UpdateConfig, recordID int64, value, recordType, subDomain string, opts RecordOptions, logger *logrus.Logger) {
+	if subDomain == "" {
+		subDomain = "@"
+	}
+
+	current, err := DescribeRecord(cfg.SecretID, cfg.SecretKey, cfg.Domain, recordID)
+	if err != nil {
+		logger.Warnf("[dry-run] Could not read record %d: %v", recordID, err)
+		logger.Infof("[dry-run] Would call ModifyRecord for record %d (%s.%s %s): value %s", recordID, subDomain, cfg.Domain, recordType, value)
+		return
+	}
+
+	after, changed := planModify(current, value, recordType, subDomain, opts)
+	if !changed {
+		logger.Infof("[dry-run] Record %d (%s.%s %s) already up to date: %s, %s",
+			recordID, subDomain, cfg.Domain, recordType, value, after)
+		return
+	}
+	logger.Infof("[dry-run] Would call ModifyRecord for record %d (%s.%s %s): value %s -> %s, %s -> %s",
+		recordID, subDomain, cfg.Domain, recordType, current.Value, value, mergeOptions(current, RecordOptions{}), after)
+}
+
+// LogIntendedCreate logs the CreateRecord request CreateRecord would send.
+func LogIntendedCreate(domain, subDomain, recordType, value string, ttl uint64, logger *logrus.Logger) {
+	if subDomain == "" {
+		subDomain = "@"
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	logger.Infof("[dry-run] Would call CreateRecord for %s.%s %s: value %s, TTL %d, line %s",
+		subDomain, domain, recordType, value, ttl, defaultRecordLine)
+}
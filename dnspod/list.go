@@ -0,0 +1,145 @@
+package dnspod
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspodapi "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// pageSize is the number of items requested per DescribeDomainList/DescribeRecordList call.
+const pageSize = 100
+
+// Domain is the subset of a DNSPod domain this program works with.
+type Domain struct {
+	ID          uint64 `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Grade       string `json:"grade"`
+	RecordCount uint64 `json:"record_count"`
+	UpdatedOn   string `json:"updated_on"`
+}
+
+// ListDomains returns every domain in the account.
+func ListDomains(secretID, secretKey string) ([]Domain, error) {
+	client, err := newClient(secretID, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSPod client: %w", err)
+	}
+
+	var domains []Domain
+	for offset := int64(0); ; offset += pageSize {
+		request := dnspodapi.NewDescribeDomainListRequest()
+		request.Offset = common.Int64Ptr(offset)
+		request.Limit = common.Int64Ptr(pageSize)
+
+		response, err := client.DescribeDomainList(request)
+		if err != nil {
+			if isNoData(err) {
+				break
+			}
+			return nil, apiError("DescribeDomainList", err)
+		}
+		for _, item := range response.Response.DomainList {
+			domains = append(domains, Domain{
+				ID:          uint64Value(item.DomainId),
+				Name:        stringValue(item.Name),
+				Status:      stringValue(item.Status),
+				Grade:       stringValue(item.Grade),
+				RecordCount: uint64Value(item.RecordCount),
+				UpdatedOn:   stringValue(item.UpdatedOn),
+			})
+		}
+		if len(response.Response.DomainList) < pageSize {
+			break
+		}
+	}
+	return domains, nil
+}
+
+// ListRecords returns the records of domain. When recordType or subDomain is
+// not empty, only matching records are returned.
+func ListRecords(secretID, secretKey, domain, recordType, subDomain string) ([]Record, error) {
+	client, err := newClient(secretID, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSPod client: %w", err)
+	}
+
+	var records []Record
+	for offset := uint64(0); ; offset += pageSize {
+		request := dnspodapi.NewDescribeRecordListRequest()
+		request.Domain = common.StringPtr(domain)
+		request.Offset = common.Uint64Ptr(offset)
+		request.Limit = common.Uint64Ptr(pageSize)
+		if recordType != "" {
+			request.RecordType = common.StringPtr(recordType)
+		}
+		if subDomain != "" {
+			request.Subdomain = common.StringPtr(subDomain)
+		}
+
+		response, err := client.DescribeRecordList(request)
+		if err != nil {
+			if isNoData(err) {
+				break
+			}
+			return nil, apiError("DescribeRecordList", err)
+		}
+		for _, item := range response.Response.RecordList {
+			records = append(records, Record{
+				ID:        uint64Value(item.RecordId),
+				SubDomain: stringValue(item.Name),
+				Type:      stringValue(item.Type),
+				Line:      stringValue(item.Line),
+				LineID:    stringValue(item.LineId),
+				Value:     stringValue(item.Value),
+				TTL:       uint64Value(item.TTL),
+				Weight:    item.Weight,
+				MX:        uint64Value(item.MX),
+				Remark:    stringValue(item.Remark),
+				Status:    stringValue(item.Status),
+				UpdatedOn: stringValue(item.UpdatedOn),
+			})
+		}
+		if len(response.Response.RecordList) < pageSize {
+			break
+		}
+	}
+	return records, nil
+}
+
+// CreateRecord adds a record on the default line and returns its ID.
+func CreateRecord(secretID, secretKey, domain, subDomain, recordType, value string, ttl uint64) (uint64, error) {
+	client, err := newClient(secretID, secretKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create DNSPod client: %w", err)
+	}
+
+	if subDomain == "" {
+		subDomain = "@"
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	request := dnspodapi.NewCreateRecordRequest()
+	request.Domain = common.StringPtr(domain)
+	request.SubDomain = common.StringPtr(subDomain)
+	request.RecordType = common.StringPtr(recordType)
+	request.RecordLine = common.StringPtr(defaultRecordLine)
+	request.Value = common.StringPtr(value)
+	request.TTL = common.Uint64Ptr(ttl)
+
+	response, err := client.CreateRecord(request)
+	if err != nil {
+		return 0, apiError("CreateRecord", err)
+	}
+	return uint64Value(response.Response.RecordId), nil
+}
+
+// isNoData reports whether err is the API's way of saying a list is empty.
+func isNoData(err error) bool {
+	sdkErr, ok := err.(*errors.TencentCloudSDKError)
+	return ok && strings.HasPrefix(sdkErr.GetCode(), "ResourceNotFound.NoData")
+}
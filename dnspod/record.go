@@ -0,0 +1,115 @@
+package dnspod
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	dnspodapi "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/dnspod/v20210323"
+)
+
+// Record is the subset of a DNSPod record this program works with.
+type Record struct {
+	ID        uint64  `json:"id"`
+	SubDomain string  `json:"name"`
+	Type      string  `json:"type"`
+	Line      string  `json:"line"`
+	LineID    string  `json:"line_id"`
+	Value     string  `json:"value"`
+	TTL       uint64  `json:"ttl"`
+	Weight    *uint64 `json:"weight,omitempty"` // nil when no weight is set
+	MX        uint64  `json:"mx,omitempty"`
+	Remark    string  `json:"remark,omitempty"`
+	Status    string  `json:"status"` // ENABLE or DISABLE
+	UpdatedOn string  `json:"updated_on"`
+}
+
+// DescribeRecord fetches a single record by ID. It doubles as a credential
+// check, since the API rejects invalid SecretId/SecretKey pairs.
+func DescribeRecord(secretID, secretKey, domain string, recordID int64) (*Record, error) {
+	client, err := newClient(secretID, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSPod client: %w", err)
+	}
+
+	request := dnspodapi.NewDescribeRecordRequest()
+	request.Domain = common.StringPtr(domain)
+	request.RecordId = common.Uint64Ptr(uint64(recordID))
+
+	response, err := client.DescribeRecord(request)
+	if err != nil {
+		return nil, apiError("DescribeRecord", err)
+	}
+
+	info := response.Response.RecordInfo
+	if info == nil {
+		return nil, fmt.Errorf("DescribeRecord returned no record info for %d", recordID)
+	}
+	return &Record{
+		ID:        uint64Value(info.Id),
+		SubDomain: stringValue(info.SubDomain),
+		Type:      stringValue(info.RecordType),
+		Line:      stringValue(info.RecordLine),
+		LineID:    stringValue(info.RecordLineId),
+		Value:     stringValue(info.Value),
+		TTL:       uint64Value(info.TTL),
+		Weight:    info.Weight,
+		MX:        uint64Value(info.MX),
+		Remark:    stringValue(info.Remark),
+		Status:    recordStatus(uint64Value(info.Enabled)),
+		UpdatedOn: stringValue(info.UpdatedOn),
+	}, nil
+}
+
+// recordStatus converts DescribeRecord's Enabled flag to the status strings used by DescribeRecordList.
+func recordStatus(enabled uint64) string {
+	if enabled == 1 {
+		return "ENABLE"
+	}
+	return "DISABLE"
+}
+
+// IsAuthError reports whether err was caused by rejected credentials.
+func IsAuthError(err error) bool {
+	var e *apiErr
+	return stderrors.As(err, &e) && e.sdkErr != nil && strings.HasPrefix(e.sdkErr.GetCode(), "AuthFailure")
+}
+
+// apiErr wraps an SDK error with the action that produced it.
+type apiErr struct {
+	action string
+	sdkErr *errors.TencentCloudSDKError
+	err    error
+}
+
+func (e *apiErr) Error() string {
+	if e.sdkErr != nil {
+		return fmt.Sprintf("DNSPod %s failed: Code=%s, Message=%s, RequestId=%s", e.action, e.sdkErr.GetCode(), e.sdkErr.GetMessage(), e.sdkErr.GetRequestId())
+	}
+	return fmt.Sprintf("failed to invoke %s API: %v", e.action, e.err)
+}
+
+func (e *apiErr) Unwrap() error {
+	return e.err
+}
+
+func apiError(action string, err error) error {
+	sdkErr, _ := err.(*errors.TencentCloudSDKError)
+	return &apiErr{action: action, sdkErr: sdkErr, err: err}
+}
+
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func uint64Value(p *uint64) uint64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,135 @@
+package dnspod
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// RecordOptions are the record settings sent with ModifyRecord besides the
+// value. Unset fields keep what the record currently has in DNSPod, so changes
+// made in the console are not overwritten.
+type RecordOptions struct {
+	Line   string  // Line name such as 电信, 联通, 移动, 境外, or a line ID such as 10=1
+	TTL    uint64  // 0 keeps the current TTL
+	Weight *uint64 // 0-100, 0 disables weighting
+	Remark *string // "" removes the remark
+}
+
+var lineIDPattern = regexp.MustCompile(`^\d+=\d+$`)
+
+// IsLineID reports whether line is a DNSPod line ID such as 10=1 rather than a line name.
+func IsLineID(line string) bool {
+	return lineIDPattern.MatchString(line)
+}
+
+// modifyPlan is the complete set of record settings one ModifyRecord call sends.
+type modifyPlan struct {
+	Line   string
+	LineID string // Takes precedence over Line in the API
+	TTL    uint64
+	Weight *uint64
+	MX     *uint64 // Kept from the live record
+	Remark string
+	Status string
+}
+
+// planModify returns the ModifyRecord settings that give the live record
+// value and opts, and whether they differ from what the record has, so
+// unchanged records need no write.
+func planModify(live *Record, value, recordType, subDomain string, opts RecordOptions) (modifyPlan, bool) {
+	if subDomain == "" {
+		subDomain = "@"
+	}
+	current, plan := mergeOptions(live, RecordOptions{}), mergeOptions(live, opts)
+	changed := !sameAddress(live.Value, value) || live.Type != recordType || live.SubDomain != subDomain || !current.equal(plan)
+	return plan, changed
+}
+
+// mergeOptions merges opts over the live record. ModifyRecord resets settings
+// that are not sent (e.g. Status back to ENABLE), so every field is filled in.
+func mergeOptions(live *Record, opts RecordOptions) modifyPlan {
+	plan := modifyPlan{
+		Line:   live.Line,
+		LineID: live.LineID,
+		TTL:    live.TTL,
+		Weight: live.Weight,
+		Remark: live.Remark,
+		Status: live.Status,
+	}
+	if live.MX != 0 {
+		mx := live.MX
+		plan.MX = &mx
+	}
+	if plan.Line == "" && plan.LineID == "" {
+		plan.Line = defaultRecordLine
+	}
+	if plan.TTL == 0 {
+		plan.TTL = DefaultTTL
+	}
+
+	switch {
+	case opts.Line == "":
+	case IsLineID(opts.Line):
+		// RecordLine is still required; the API uses the ID when both are sent.
+		plan.LineID = opts.Line
+	default:
+		plan.Line, plan.LineID = opts.Line, ""
+	}
+	if opts.TTL != 0 {
+		plan.TTL = opts.TTL
+	}
+	if opts.Weight != nil {
+		plan.Weight = opts.Weight
+	}
+	if opts.Remark != nil {
+		plan.Remark = *opts.Remark
+	}
+	return plan
+}
+
+// equal reports whether p and o send the same settings.
+func (p modifyPlan) equal(o modifyPlan) bool {
+	return p.Line == o.Line && p.LineID == o.LineID && p.TTL == o.TTL &&
+		optionalEqual(p.Weight, o.Weight) && optionalEqual(p.MX, o.MX) &&
+		p.Remark == o.Remark && p.Status == o.Status
+}
+
+func (p modifyPlan) String() string {
+	parts := []string{"line " + p.Line}
+	if p.LineID != "" {
+		parts[0] += " (" + p.LineID + ")"
+	}
+	parts = append(parts, fmt.Sprintf("TTL %d", p.TTL))
+	if p.Weight != nil {
+		parts = append(parts, fmt.Sprintf("weight %d", *p.Weight))
+	}
+	if p.MX != nil {
+		parts = append(parts, fmt.Sprintf("MX %d", *p.MX))
+	}
+	if p.Remark != "" {
+		parts = append(parts, fmt.Sprintf("remark %q", p.Remark))
+	}
+	if p.Status != "" && p.Status != "ENABLE" {
+		parts = append(parts, "status "+p.Status)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sameAddress compares record values as IP addresses where possible, since
+// the API may spell an IPv6 address differently from the detected one.
+func sameAddress(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB)
+}
+
+func optionalEqual(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,72 @@
+package dnspod
+
+import (
+	"testing"
+)
+
+func uint64Ptr(v uint64) *uint64 { return &v }
+func stringPtr(v string) *string { return &v }
+
+func TestPlanModify(t *testing.T) {
+	live := Record{
+		ID: 1, SubDomain: "home", Type: "A", Value: "203.0.113.1",
+		Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE",
+	}
+	tests := []struct {
+		name        string
+		live        Record
+		value       string
+		recordType  string
+		subDomain   string
+		opts        RecordOptions
+		wantChanged bool
+		want        modifyPlan
+	}{
+		{name: "unchanged", value: "203.0.113.1", subDomain: "home", wantChanged: false,
+			want: modifyPlan{Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "options equal to the live record", value: "203.0.113.1", subDomain: "home",
+			opts:        RecordOptions{Line: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: stringPtr("router")},
+			wantChanged: false,
+			want:        modifyPlan{Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "new address keeps the settings", value: "203.0.113.2", subDomain: "home", wantChanged: true,
+			want: modifyPlan{Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "renamed subdomain", value: "203.0.113.1", subDomain: "office", wantChanged: true,
+			want: modifyPlan{Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "other record type", value: "203.0.113.1", recordType: "AAAA", subDomain: "home", wantChanged: true,
+			want: modifyPlan{Line: "电信", LineID: "10=1", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "line name replaces the line ID", value: "203.0.113.1", subDomain: "home",
+			opts: RecordOptions{Line: "联通"}, wantChanged: true,
+			want: modifyPlan{Line: "联通", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "line ID keeps the line name", value: "203.0.113.1", subDomain: "home",
+			opts: RecordOptions{Line: "10=2"}, wantChanged: true,
+			want: modifyPlan{Line: "电信", LineID: "10=2", TTL: 600, Weight: uint64Ptr(10), Remark: "router", Status: "DISABLE"}},
+		{name: "TTL, weight and remark", value: "203.0.113.1", subDomain: "home",
+			opts: RecordOptions{TTL: 120, Weight: uint64Ptr(0), Remark: stringPtr("")}, wantChanged: true,
+			want: modifyPlan{Line: "电信", LineID: "10=1", TTL: 120, Weight: uint64Ptr(0), Status: "DISABLE"}},
+		{name: "defaults for a bare record", live: Record{SubDomain: "@", Type: "A", Value: "203.0.113.1", MX: 5},
+			value: "203.0.113.1", wantChanged: false,
+			want: modifyPlan{Line: defaultRecordLine, TTL: DefaultTTL, MX: uint64Ptr(5)}},
+		{name: "IPv6 spelled differently", live: Record{SubDomain: "@", Type: "AAAA", Value: "2001:DB8:0:0::1", Line: "默认", TTL: 600},
+			value: "2001:db8::1", recordType: "AAAA", wantChanged: false,
+			want: modifyPlan{Line: "默认", TTL: 600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tt.live
+			if rec.Type == "" {
+				rec = live
+			}
+			recordType := tt.recordType
+			if recordType == "" {
+				recordType = "A"
+			}
+			plan, changed := planModify(&rec, tt.value, recordType, tt.subDomain, tt.opts)
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %t, want %t", changed, tt.wantChanged)
+			}
+			if !plan.equal(tt.want) {
+				t.Errorf("plan = %s, want %s", plan, tt.want)
+			}
+		})
+	}
+}
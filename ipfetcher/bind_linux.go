@@ -0,0 +1,28 @@
+package ipfetcher
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// canBindToDevice reports whether sockets can be tied to an interface, so
+// that routing follows the interface rather than just its address.
+const canBindToDevice = true
+
+// bindToDevice returns a net.Dialer Control function that sets SO_BINDTODEVICE.
+// It needs CAP_NET_RAW on kernels before 5.7.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("failed to bind to interface %s: %w", name, sockErr)
+		}
+		return nil
+	}
+}
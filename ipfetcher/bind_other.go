@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ipfetcher
+
+import "syscall"
+
+// canBindToDevice is false outside Linux: an interface binding only selects
+// the interface's address as the source address.
+const canBindToDevice = false
+
+func bindToDevice(string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package ipfetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Family restricts a lookup to one IP version.
+type Family int
+
+const (
+	AnyFamily Family = iota
+	IPv4
+	IPv6
+)
+
+func (f Family) String() string {
+	switch f {
+	case IPv4:
+		return "IPv4"
+	case IPv6:
+		return "IPv6"
+	default:
+		return "any"
+	}
+}
+
+// matches reports whether ip belongs to family f.
+func (f Family) matches(ip net.IP) bool {
+	switch f {
+	case IPv4:
+		return ip.To4() != nil
+	case IPv6:
+		return ip.To4() == nil && ip.To16() != nil
+	default:
+		return true
+	}
+}
+
+// ParseFamily parses "ipv4" or "ipv6"; "" means AnyFamily.
+func ParseFamily(s string) (Family, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return AnyFamily, nil
+	case "ipv4":
+		return IPv4, nil
+	case "ipv6":
+		return IPv6, nil
+	default:
+		return AnyFamily, fmt.Errorf("unknown address family %q, expected ipv4 or ipv6", s)
+	}
+}
+
+// Binding selects the local side of connections made by a source, so that on
+// multi-WAN hosts each address is detected over the right uplink.
+type Binding struct {
+	Interface     string // Connect over this interface (SO_BINDTODEVICE on Linux, its address elsewhere)
+	SourceAddress string // Connect from this local address
+	Family        Family // Connect over this IP version only, and expect an address of it
+}
+
+// IsZero reports whether b leaves the route and address family to the system.
+func (b Binding) IsZero() bool {
+	return b == Binding{}
+}
+
+// String describes b for logs, e.g. " via eth1".
+func (b Binding) String() string {
+	switch {
+	case b.Interface != "":
+		return " via " + b.Interface
+	case b.SourceAddress != "":
+		return " from " + b.SourceAddress
+	default:
+		return ""
+	}
+}
+
+// localIP returns the address connections are made from, or nil for any.
+func (b Binding) localIP() (net.IP, error) {
+	if b.SourceAddress != "" {
+		ip := net.ParseIP(b.SourceAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", b.SourceAddress)
+		}
+		if !b.Family.matches(ip) {
+			return nil, fmt.Errorf("source address %s is not an %s address", ip, b.Family)
+		}
+		return ip, nil
+	}
+	if b.Interface != "" {
+		if canBindToDevice {
+			// The device binding routes the connection; the kernel picks the
+			// matching source address, which also works for point-to-point links.
+			if _, err := net.InterfaceByName(b.Interface); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+		return InterfaceAddress(b.Interface, b.Family)
+	}
+	return nil, nil
+}
+
+// InterfaceAddress returns the first global unicast address of family on the interface.
+func InterfaceAddress(name string, family Family) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of %s: %w", name, err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.IsGlobalUnicast() && family.matches(ipNet.IP) {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no %s address", name, family)
+}
+
+// network restricts "tcp" or "udp" to b's family, e.g. "tcp4".
+func (b Binding) network(base string) string {
+	switch b.Family {
+	case IPv4:
+		return base + "4"
+	case IPv6:
+		return base + "6"
+	default:
+		return base
+	}
+}
+
+// dial returns a DialContext function for b. The requested network ("tcp"
+// or "udp") is restricted to b's family and connects from the bound address.
+func (b Binding) dial() (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	local, err := b.localIP()
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		base := strings.TrimRight(network, "46")
+		if local != nil {
+			if base == "udp" {
+				dialer.LocalAddr = &net.UDPAddr{IP: local}
+			} else {
+				dialer.LocalAddr = &net.TCPAddr{IP: local}
+			}
+		}
+		if b.Interface != "" && canBindToDevice {
+			dialer.Control = bindToDevice(b.Interface)
+		}
+		return dialer.DialContext(ctx, b.network(base), addr)
+	}, nil
+}
+
+// httpClient returns the client to use for b: the shared client when b is
+// zero, otherwise a client whose connections start from the bound address.
+func (b Binding) httpClient() (*http.Client, error) {
+	shared, base := sharedClient()
+	if b.IsZero() {
+		return shared, nil
+	}
+	dial, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	// Through a proxy, the interface and source address apply to the
+	// connection to the proxy, but the family does not: the proxy connects to
+	// the target, and Fetch checks the family of the address it reports. As in
+	// lanClient, the proxy is therefore reached over either family.
+	anyFamily := b
+	anyFamily.Family = AnyFamily
+	proxyDial, err := anyFamily.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := base.Clone()
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		if viaProxy, _ := ctx.Value(viaProxyKey{}).(bool); viaProxy {
+			return proxyDial(ctx, "tcp", addr)
+		}
+		return dial(ctx, "tcp", addr)
+	}
+	// The interface address can change between cycles, so connections are not reused.
+	transport.DisableKeepAlives = true
+	return &http.Client{Timeout: lookupTimeout, Transport: proxyMarkingTransport{transport}}, nil
+}
+
+// viaProxyKey marks the context of requests that are sent through a proxy.
+type viaProxyKey struct{}
+
+// proxyMarkingTransport tells its DialContext, through the request context,
+// whether the connection it makes is to a proxy or to the target itself.
+type proxyMarkingTransport struct {
+	*http.Transport
+}
+
+func (t proxyMarkingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Proxy != nil {
+		if u, err := t.Proxy(req); err == nil && u != nil {
+			req = req.WithContext(context.WithValue(req.Context(), viaProxyKey{}, true))
+		}
+	}
+	return t.Transport.RoundTrip(req)
+}
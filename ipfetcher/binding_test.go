@@ -0,0 +1,52 @@
+package ipfetcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// useTestProxy sends every later lookup to a non-loopback host through a
+// fake HTTP proxy on 127.0.0.1 that answers with ip.
+func useTestProxy(t *testing.T, ip string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, ip)
+	}))
+	t.Cleanup(srv.Close)
+	proxyURL, _ := url.Parse(srv.URL)
+	UseProxy(func(req *http.Request) (*url.URL, error) {
+		if req.URL.Hostname() == "127.0.0.1" {
+			return nil, nil
+		}
+		return proxyURL, nil
+	})
+	t.Cleanup(func() { UseProxy(http.ProxyFromEnvironment) })
+}
+
+func TestBindingFamilyWithProxy(t *testing.T) {
+	// The proxy listens on IPv4 only. An IPv6 lookup still reaches it: the
+	// family applies to the address the proxy reports, not to the proxy.
+	useTestProxy(t, "2001:db8::1")
+	checkFetch(t, HTTPSource{URL: "http://ipv6.example.test/", Binding: Binding{Family: IPv6}}, "2001:db8::1", "")
+	checkFetch(t, HTTPSource{URL: "http://ipv4.example.test/", Binding: Binding{Family: IPv4}}, "", "not an IPv4 address")
+	checkFetch(t, HTTPSource{URL: "http://example.test/", Binding: Binding{SourceAddress: "127.0.0.1"}}, "2001:db8::1", "")
+}
+
+func TestBindingFamilyWithoutProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "192.0.2.1")
+	}))
+	defer srv.Close()
+
+	checkFetch(t, HTTPSource{URL: srv.URL, Binding: Binding{Family: IPv4}}, "192.0.2.1", "")
+	// Direct connections are restricted to the family, so the IPv4-only
+	// server cannot be reached over IPv6.
+	checkFetch(t, HTTPSource{URL: srv.URL, Binding: Binding{Family: IPv6}}, "", "failed to get IP")
+}
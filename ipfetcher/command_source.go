@@ -0,0 +1,110 @@
+package ipfetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultCommandTimeout bounds a CommandSource without its own Timeout.
+const DefaultCommandTimeout = 10 * time.Second
+
+// CommandSource runs a program and reads the address from the first line of
+// its output, for setups no built-in source covers. The program is run
+// directly, not through a shell. It gets the lookup in the environment:
+// DDNS_IP_FAMILY (ipv4 or ipv6), and DDNS_INTERFACE or DDNS_SOURCE_ADDRESS
+// when the source is bound, so one script can serve several lists.
+type CommandSource struct {
+	Name    string   // Set for [[ip_source]] tables, shown in logs
+	Command []string // Program and arguments
+	Timeout time.Duration
+	Binding Binding
+}
+
+func (s CommandSource) String() string {
+	desc := "command " + strings.Join(s.Command, " ") + s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s CommandSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	if len(s.Command) == 0 {
+		return IPDetails{}, fmt.Errorf("%s: no command configured", s)
+	}
+	output, err := s.run()
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	ip, err := parseAddress(line)
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("%s printed %w", s, err)
+	}
+	if !s.Binding.Family.matches(ip) {
+		return IPDetails{}, fmt.Errorf("%s printed %s, which is not an %s address", s, ip, s.Binding.Family)
+	}
+	if !isPublic(ip) {
+		return IPDetails{}, fmt.Errorf("%s printed %s, which is not a public address", s, ip)
+	}
+	logger.Debugf("Fetched IP %s from %s", ip, s)
+	return IPDetails{IP: ip.String()}, nil
+}
+
+func (s CommandSource) run() (string, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Env = append(os.Environ(), s.environment()...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children that keep the output open, such as a lingering ssh, must not
+	// hold up the update cycle once the program is killed.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("did not finish within %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			msg, _, _ = strings.Cut(msg, "\n")
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return "", fmt.Errorf("printed nothing")
+	}
+	return stdout.String(), nil
+}
+
+// environment describes the lookup to the program.
+func (s CommandSource) environment() []string {
+	var env []string
+	switch s.Binding.Family {
+	case IPv4:
+		env = append(env, "DDNS_IP_FAMILY=ipv4")
+	case IPv6:
+		env = append(env, "DDNS_IP_FAMILY=ipv6")
+	}
+	if s.Binding.Interface != "" {
+		env = append(env, "DDNS_INTERFACE="+s.Binding.Interface)
+	}
+	if s.Binding.SourceAddress != "" {
+		env = append(env, "DDNS_SOURCE_ADDRESS="+s.Binding.SourceAddress)
+	}
+	return env
+}
@@ -0,0 +1,71 @@
+package ipfetcher
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// shellSource runs script with sh -c.
+func shellSource(script string) CommandSource {
+	return CommandSource{Command: []string{"sh", "-c", script}}
+}
+
+func TestCommandSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	tests := []struct {
+		name    string
+		src     CommandSource
+		want    string
+		wantErr string
+	}{
+		{name: "address", src: shellSource("echo 203.0.113.7"), want: "203.0.113.7"},
+		{name: "surrounding whitespace", src: shellSource(`printf '\n  203.0.113.7 \r\n'`), want: "203.0.113.7"},
+		{name: "first line only", src: shellSource(`printf '203.0.113.7\n198.51.100.1\n'`), want: "203.0.113.7"},
+		{name: "prefix length", src: shellSource("echo 2001:db8::1/64"), want: "2001:db8::1"},
+		{name: "lookup environment", src: CommandSource{
+			Command: []string{"sh", "-c", `[ "$DDNS_IP_FAMILY" = ipv6 ] && [ "$DDNS_INTERFACE" = wan1 ] && echo 2001:db8::2`},
+			Binding: Binding{Interface: "wan1", Family: IPv6},
+		}, want: "2001:db8::2"},
+		{name: "non-zero exit with stderr", src: shellSource("echo 'no route' >&2; echo 'details' >&2; exit 3"), wantErr: "exit status 3: no route"},
+		{name: "non-zero exit", src: shellSource("echo 203.0.113.7; exit 1"), wantErr: "exit status 1"},
+		{name: "no output", src: shellSource("true"), wantErr: "printed nothing"},
+		{name: "blank output", src: shellSource(`printf ' \n\n'`), wantErr: "printed nothing"},
+		{name: "not an address", src: shellSource("echo unknown"), wantErr: `"unknown" is not an IP address`},
+		{name: "private address", src: shellSource("echo 192.168.1.2"), wantErr: "not a public address"},
+		{name: "CGNAT address", src: shellSource("echo 100.64.0.1"), wantErr: "not a public address"},
+		{name: "link-local IPv6", src: shellSource("echo fe80::1"), wantErr: "not a public address"},
+		{name: "wrong family", src: CommandSource{Command: []string{"sh", "-c", "echo 203.0.113.7"}, Binding: Binding{Family: IPv6}},
+			wantErr: "not an IPv6 address"},
+		{name: "missing program", src: CommandSource{Command: []string{"/nonexistent/ddns-ip"}}, wantErr: "no such file"},
+		{name: "no command", src: CommandSource{}, wantErr: "no command configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkFetch(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestCommandSourceTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	for name, script := range map[string]string{
+		"slow program": "sleep 10",
+		// The background child keeps stdout open after sh is killed.
+		"lingering child": "sleep 10 & sleep 10",
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := shellSource(script)
+			src.Timeout = 200 * time.Millisecond
+			start := time.Now()
+			checkFetch(t, src, "", "did not finish within 200ms")
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Fetch() took %s, want it to give up after the timeout", elapsed)
+			}
+		})
+	}
+}
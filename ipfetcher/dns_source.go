@@ -0,0 +1,248 @@
+package ipfetcher
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTimeout bounds the query to each resolver. It is a variable so tests
+// can shorten it.
+var dnsTimeout = 5 * time.Second
+
+// DNSSource asks a DNS server that answers with the address the query came
+// from, such as OpenDNS for myip.opendns.com. DNS lookups are often allowed
+// where HTTP services are blocked or rate-limited, and they are not proxied.
+type DNSSource struct {
+	Name      string   // Set for [[ip_source]] tables and presets, shown in logs
+	Resolvers []string // host or host:port, tried in order; port 53 by default
+	QueryName string
+	QueryType string // A, AAAA or TXT; empty means A or AAAA according to Binding.Family
+	Binding   Binding
+}
+
+func (s DNSSource) String() string {
+	desc := "dns://" + strings.Join(s.Resolvers, ",") + "/" + s.QueryName + "?type=" + s.queryType() + s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+func (s DNSSource) queryType() string {
+	if s.QueryType != "" {
+		return strings.ToUpper(s.QueryType)
+	}
+	if s.Binding.Family == IPv6 {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s DNSSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	if len(s.Resolvers) == 0 {
+		return IPDetails{}, fmt.Errorf("%s: no resolvers configured", s)
+	}
+	dial, err := s.Binding.dial()
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("%s: %w", s, err)
+	}
+	// A fully qualified name keeps the search domains from resolv.conf out.
+	name := strings.TrimSuffix(s.QueryName, ".") + "."
+
+	var errs []string
+	for _, resolver := range s.Resolvers {
+		server := resolverAddress(resolver)
+		ip, err := s.lookup(dial, server, name)
+		if err != nil {
+			logger.Debugf("DNS lookup of %s via %s failed: %v", name, server, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", server, err))
+			continue
+		}
+		if !s.Binding.Family.matches(ip) {
+			errs = append(errs, fmt.Sprintf("%s: answered %s, which is not an %s address", server, ip, s.Binding.Family))
+			continue
+		}
+		logger.Debugf("Fetched IP %s from %s", ip, s)
+		return IPDetails{IP: ip.String()}, nil
+	}
+	return IPDetails{}, fmt.Errorf("failed to get IP from %s: %s", s, strings.Join(errs, "; "))
+}
+
+// lookup sends one query for name to server and returns the first address in
+// the answer. Unlike net.Resolver, it neither reads resolv.conf nor retries,
+// so a dead resolver costs one dnsTimeout.
+func (s DNSSource) lookup(dial dialFunc, server, name string) (net.IP, error) {
+	var qtype dnsmessage.Type
+	switch s.queryType() {
+	case "A":
+		qtype = dnsmessage.TypeA
+	case "AAAA":
+		qtype = dnsmessage.TypeAAAA
+	case "TXT":
+		qtype = dnsmessage.TypeTXT
+	default:
+		return nil, fmt.Errorf("unsupported query type %q, expected A, AAAA or TXT", s.QueryType)
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query name %q: %w", name, err)
+	}
+	id := uint16(rand.Uint32())
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	resp, err := dnsExchange(ctx, dial, "udp", server, id, query)
+	if err == nil && resp.Truncated {
+		// The answer did not fit in a datagram; ask again over TCP.
+		resp, err = dnsExchange(ctx, dial, "tcp", server, id, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("server answered %s", rcodeText(resp.RCode))
+	}
+
+	var texts []string
+	for _, answer := range resp.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			if qtype == dnsmessage.TypeA {
+				return net.IP(body.A[:]), nil
+			}
+		case *dnsmessage.AAAAResource:
+			if qtype == dnsmessage.TypeAAAA {
+				return net.IP(body.AAAA[:]), nil
+			}
+		case *dnsmessage.TXTResource:
+			if qtype != dnsmessage.TypeTXT {
+				continue
+			}
+			// Answers may carry other strings, e.g. Google's "edns0-client-subnet ...".
+			for _, txt := range body.TXT {
+				if ip := net.ParseIP(strings.Trim(strings.TrimSpace(txt), `"`)); ip != nil {
+					return ip, nil
+				}
+				texts = append(texts, txt)
+			}
+		}
+	}
+	if qtype == dnsmessage.TypeTXT && len(texts) > 0 {
+		return nil, fmt.Errorf("no IP address in TXT answer %q", texts)
+	}
+	return nil, fmt.Errorf("no %s record in the answer", s.queryType())
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dnsExchange sends query to server over network ("udp" or "tcp") and
+// returns the response with the matching id.
+func dnsExchange(ctx context.Context, dial dialFunc, network, server string, id uint16, query []byte) (*dnsmessage.Message, error) {
+	conn, err := dial(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+		return parseDNSResponse(buf, id)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1232)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("no answer within %s", dnsTimeout)
+			}
+			return nil, err
+		}
+		resp, err := parseDNSResponse(buf[:n], id)
+		if errors.Is(err, errOtherDNSResponse) {
+			continue // A late answer to an earlier query
+		}
+		return resp, err
+	}
+}
+
+var errOtherDNSResponse = errors.New("response to another query")
+
+func parseDNSResponse(buf []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(buf); err != nil {
+		var header dnsmessage.Parser
+		if h, herr := header.Start(buf); herr == nil && (h.ID != id || !h.Response) {
+			return nil, errOtherDNSResponse
+		}
+		return nil, fmt.Errorf("malformed answer: %w", err)
+	}
+	if msg.ID != id || !msg.Response {
+		return nil, errOtherDNSResponse
+	}
+	return &msg, nil
+}
+
+// rcodeText names the common failure codes the way dig does.
+func rcodeText(code dnsmessage.RCode) string {
+	switch code {
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("rcode %d", code)
+	}
+}
+
+// resolverAddress adds the default port 53 to a resolver without one.
+func resolverAddress(resolver string) string {
+	if _, _, err := net.SplitHostPort(resolver); err == nil {
+		return resolver
+	}
+	return net.JoinHostPort(strings.Trim(resolver, "[]"), "53")
+}
@@ -0,0 +1,147 @@
+package ipfetcher
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsReply answers query with the given resource bodies, or with rcode.
+func dnsReply(t *testing.T, query []byte, rcode dnsmessage.RCode, bodies ...dnsmessage.ResourceBody) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		t.Errorf("responder got a malformed query: %v", err)
+		return nil
+	}
+	msg.Response = true
+	msg.RCode = rcode
+	q := msg.Questions[0]
+	for _, body := range bodies {
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 0},
+			Body:   body,
+		})
+	}
+	resp, err := msg.Pack()
+	if err != nil {
+		t.Errorf("packing the response: %v", err)
+		return nil
+	}
+	return resp
+}
+
+func shortDNSTimeout(t *testing.T) {
+	old := dnsTimeout
+	dnsTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { dnsTimeout = old })
+}
+
+func TestDNSSource(t *testing.T) {
+	shortDNSTimeout(t)
+	v4 := &dnsmessage.AResource{A: [4]byte{203, 0, 113, 5}}
+	v6 := &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 5}}
+	tests := []struct {
+		name      string
+		queryType string
+		reply     func(t *testing.T, query []byte) []byte
+		want      string
+		wantErr   string
+	}{
+		{name: "A", queryType: "A", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeSuccess, v4)
+		}, want: "203.0.113.5"},
+		{name: "AAAA", queryType: "AAAA", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeSuccess, v6)
+		}, want: "2001:db8::5"},
+		{name: "TXT", queryType: "TXT", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeSuccess,
+				&dnsmessage.TXTResource{TXT: []string{"edns0-client-subnet 198.51.100.0/24"}},
+				&dnsmessage.TXTResource{TXT: []string{"203.0.113.6"}})
+		}, want: "203.0.113.6"},
+		{name: "TXT without an address", queryType: "TXT", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeSuccess, &dnsmessage.TXTResource{TXT: []string{"hello"}})
+		}, wantErr: `no IP address in TXT answer ["hello"]`},
+		{name: "malformed TXT", queryType: "TXT", reply: func(t *testing.T, q []byte) []byte {
+			resp := dnsReply(t, q, dnsmessage.RCodeSuccess, &dnsmessage.TXTResource{TXT: []string{"x"}})
+			// The string claims more bytes than the record holds.
+			resp[len(resp)-2] = 9
+			return resp
+		}, wantErr: "malformed answer"},
+		{name: "wrong record type", queryType: "A", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeSuccess, v6)
+		}, wantErr: "no A record in the answer"},
+		{name: "NXDOMAIN", queryType: "A", reply: func(t *testing.T, q []byte) []byte {
+			return dnsReply(t, q, dnsmessage.RCodeNameError)
+		}, wantErr: "server answered NXDOMAIN"},
+		{name: "ignores other IDs", queryType: "A", reply: func(t *testing.T, q []byte) []byte {
+			resp := dnsReply(t, q, dnsmessage.RCodeSuccess, v4)
+			resp[0] ^= 0xff
+			return resp
+		}, wantErr: "no answer within"},
+		{name: "timeout", queryType: "A", reply: func(*testing.T, []byte) []byte { return nil },
+			wantErr: "no answer within"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeUDPServer(t, func(q []byte) []byte { return tt.reply(t, q) })
+			src := DNSSource{Resolvers: []string{server.addr()}, QueryName: "myip.example", QueryType: tt.queryType}
+			checkFetch(t, src, tt.want, tt.wantErr)
+			// One query per resolver, whatever resolv.conf says.
+			if n := len(server.received()); n != 1 {
+				t.Errorf("server received %d queries, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDNSSourceFallsBackToTCP(t *testing.T) {
+	shortDNSTimeout(t)
+	udp := newFakeUDPServer(t, func(q []byte) []byte {
+		resp := dnsReply(t, q, dnsmessage.RCodeSuccess)
+		resp[2] |= 0x02 // TC
+		return resp
+	})
+	// A TCP listener on the same port answers in full.
+	ln, err := net.Listen("tcp", udp.addr())
+	if err != nil {
+		t.Skipf("cannot listen on TCP %s: %v", udp.addr(), err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		q := make([]byte, int(size[0])<<8|int(size[1]))
+		if _, err := io.ReadFull(conn, q); err != nil {
+			return
+		}
+		resp := dnsReply(t, q, dnsmessage.RCodeSuccess, &dnsmessage.AResource{A: [4]byte{203, 0, 113, 7}})
+		conn.Write(append([]byte{byte(len(resp) >> 8), byte(len(resp))}, resp...))
+	}()
+
+	src := DNSSource{Resolvers: []string{udp.addr()}, QueryName: "myip.example"}
+	checkFetch(t, src, "203.0.113.7", "")
+}
+
+func TestDNSSourceTriesResolversInOrder(t *testing.T) {
+	shortDNSTimeout(t)
+	dead := newFakeUDPServer(t, func([]byte) []byte { return nil })
+	live := newFakeUDPServer(t, func(q []byte) []byte {
+		return dnsReply(t, q, dnsmessage.RCodeSuccess, &dnsmessage.AResource{A: [4]byte{203, 0, 113, 8}})
+	})
+	src := DNSSource{Resolvers: []string{dead.addr(), live.addr()}, QueryName: "myip.example"}
+	start := time.Now()
+	checkFetch(t, src, "203.0.113.8", "")
+	if elapsed := time.Since(start); elapsed > 2*dnsTimeout {
+		t.Errorf("lookup took %s, want one timeout for the dead resolver", elapsed)
+	}
+}
@@ -0,0 +1,111 @@
+package ipfetcher
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultGateway returns the next hop of the default route for family,
+// preferring routes over iface when it is set. IPv6 link-local gateways
+// carry the interface as their zone, e.g. "fe80::1%eth0".
+func DefaultGateway(family Family, iface string) (string, error) {
+	if family == IPv6 {
+		return defaultGatewayIPv6(iface)
+	}
+	return defaultGatewayIPv4(iface)
+}
+
+func defaultGatewayIPv4(iface string) (string, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseIPv4Routes(f, iface, binary.NativeEndian)
+}
+
+// parseIPv4Routes finds the default gateway in /proc/net/route content. The
+// kernel prints each address as a 32-bit number in the host's byte order,
+// so order must be the byte order of the host that wrote it.
+func parseIPv4Routes(r io.Reader, iface string, order binary.ByteOrder) (string, error) {
+	best, bestMetric := "", uint64(math.MaxUint64)
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		if iface != "" && fields[0] != iface {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		metric, _ := strconv.ParseUint(fields[6], 10, 32)
+		gateway, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || flags&0x2 == 0 { // RTF_GATEWAY
+			continue
+		}
+		if metric < bestMetric {
+			ip := make(net.IP, 4)
+			order.PutUint32(ip, uint32(gateway))
+			best, bestMetric = ip.String(), metric
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no IPv4 default route%s", onInterface(iface))
+	}
+	return best, scanner.Err()
+}
+
+func defaultGatewayIPv6(iface string) (string, error) {
+	f, err := os.Open("/proc/net/ipv6_route")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	best, bestMetric := "", uint64(math.MaxUint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// dest dest_len src src_len next_hop metric refcnt use flags iface
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" || strings.Trim(fields[4], "0") == "" {
+			continue
+		}
+		if iface != "" && fields[9] != iface {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[4])
+		if err != nil || len(raw) != 16 {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[5], 16, 32)
+		if metric < bestMetric {
+			gw := net.IP(raw).String()
+			if net.IP(raw).IsLinkLocalUnicast() {
+				gw += "%" + fields[9]
+			}
+			best, bestMetric = gw, metric
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no IPv6 default route%s", onInterface(iface))
+	}
+	return best, scanner.Err()
+}
+
+func onInterface(iface string) string {
+	if iface == "" {
+		return ""
+	}
+	return " on " + iface
+}
@@ -0,0 +1,42 @@
+package ipfetcher
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestParseIPv4Routes(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	// The same table as printed by a little-endian (x86, ARM) and a
+	// big-endian (MIPS) kernel: default routes via 192.168.1.1 on eth0
+	// (metric 100) and 10.0.0.1 on wwan0 (metric 50).
+	tables := []struct {
+		order  binary.ByteOrder
+		routes string
+	}{
+		{binary.LittleEndian, "eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+			"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n" +
+			"wwan0\t00000000\t0100000A\t0003\t0\t0\t50\t00000000\t0\t0\t0\n"},
+		{binary.BigEndian, "eth0\t00000000\tC0A80101\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+			"eth0\tC0A80100\t00000000\t0001\t0\t0\t100\tFFFFFF00\t0\t0\t0\n" +
+			"wwan0\t00000000\t0A000001\t0003\t0\t0\t50\t00000000\t0\t0\t0\n"},
+	}
+	for _, table := range tables {
+		for _, tt := range []struct {
+			iface, want string
+		}{
+			{"", "10.0.0.1"}, // Lowest metric
+			{"eth0", "192.168.1.1"},
+			{"wwan0", "10.0.0.1"},
+		} {
+			got, err := parseIPv4Routes(strings.NewReader(header+table.routes), tt.iface, table.order)
+			if err != nil || got != tt.want {
+				t.Errorf("%s, iface %q: got %q, %v; want %s", table.order, tt.iface, got, err, tt.want)
+			}
+		}
+		if _, err := parseIPv4Routes(strings.NewReader(header+table.routes), "eth1", table.order); err == nil {
+			t.Errorf("%s: expected an error for an interface without a default route", table.order)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ipfetcher
+
+import "fmt"
+
+// DefaultGateway is only implemented on Linux; elsewhere the gateway must be
+// configured.
+func DefaultGateway(family Family, iface string) (string, error) {
+	return "", fmt.Errorf("cannot find the default %s gateway on this system; set gateway", family)
+}
@@ -2,9 +2,15 @@ package ipfetcher
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -17,6 +23,8 @@ type IPDetails struct {
 	ContinentLong string `json:"continentLong"`
 	Flag          string `json:"flag"`
 	Country       string `json:"country"`
+
+	NATMapping string `json:"-"` // Set by STUN sources, e.g. "192.168.1.2:5000 -> 203.0.113.7:61000"
 }
 
 const (
@@ -24,32 +32,169 @@ const (
 	IPv6URL = "https://ipv6.my.ipinfo.app/api/ipDetails.php"
 )
 
+// lookupTimeout bounds every IP lookup so a stalled service cannot block an update cycle forever.
+const lookupTimeout = 15 * time.Second
+
+// httpClient is used for lookups without a Binding; baseTransport is what
+// bound clients start from. Both follow UseProxy.
+var (
+	clientMu      sync.Mutex
+	baseTransport = http.DefaultTransport.(*http.Transport).Clone()
+	httpClient    = &http.Client{Timeout: lookupTimeout, Transport: baseTransport}
+)
+
+// UseProxy sets the proxy function for all later IP lookups, in the form of
+// http.Transport.Proxy. nil means no proxy.
+func UseProxy(proxy func(*http.Request) (*url.URL, error)) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	baseTransport = transport
+	httpClient = &http.Client{Timeout: lookupTimeout, Transport: transport}
+}
+
+// sharedClient returns the current client and transport set by UseProxy.
+func sharedClient() (*http.Client, *http.Transport) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	return httpClient, baseTransport
+}
+
 // GetCurrentIP 从指定的URL获取IP地址
 func GetCurrentIP(url string, logger *logrus.Logger) (string, error) {
-	resp, err := http.Get(url)
+	ipDetails, err := GetIPDetails(url, logger)
 	if err != nil {
-		return "", fmt.Errorf("failed to get IP from %s: %w", url, err)
+		return "", err
+	}
+	return ipDetails.IP, nil
+}
+
+// GetIPDetails 从指定的URL获取IP地址及其元数据。
+// 对于只返回纯文本IP的服务，只有 IP 字段会被填充。
+func GetIPDetails(url string, logger *logrus.Logger) (IPDetails, error) {
+	return HTTPSource{URL: url}.Fetch(logger)
+}
+
+// Source is one way of finding the current public address.
+type Source interface {
+	// String names the source in logs and in the `ip` command.
+	String() string
+	Fetch(logger *logrus.Logger) (IPDetails, error)
+}
+
+// HTTPSource asks a web service such as ipinfo.app or api.ipify.org.
+type HTTPSource struct {
+	Name    string // Set for [[ip_source]] tables, shown in logs
+	URL     string
+	Binding Binding
+}
+
+func (s HTTPSource) String() string {
+	if s.Name != "" {
+		return s.Name + " (" + s.URL + s.Binding.String() + ")"
+	}
+	return s.URL + s.Binding.String()
+}
+
+// Fetch implements Source.
+func (s HTTPSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	var ipDetails IPDetails
+	url := s.URL
+	client, err := s.Binding.httpClient()
+	if err != nil {
+		return ipDetails, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return ipDetails, fmt.Errorf("failed to get IP from %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get IP from %s: status code %d", url, resp.StatusCode)
+		return ipDetails, fmt.Errorf("failed to get IP from %s: status code %d", url, resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body from %s: %w", url, err)
+		return ipDetails, fmt.Errorf("failed to read response body from %s: %w", url, err)
 	}
 
-	var ipDetails IPDetails
 	err = json.Unmarshal(body, &ipDetails)
 	if err != nil {
-		return "", fmt.Errorf("failed to unmarshal JSON response from %s: %w", url, err)
+		// Services such as api.ipify.org answer with the bare address.
+		if ip := net.ParseIP(strings.TrimSpace(string(body))); ip != nil {
+			if err := s.checkFamily(ip.String()); err != nil {
+				return ipDetails, err
+			}
+			logger.Debugf("Fetched IP %s from %s", ip, s)
+			return IPDetails{IP: ip.String()}, nil
+		}
+		return ipDetails, fmt.Errorf("failed to unmarshal JSON response from %s: %w", url, err)
 	}
 
 	if ipDetails.IP == "" {
-		return "", fmt.Errorf("no IP address found in response from %s", url)
+		return ipDetails, fmt.Errorf("no IP address found in response from %s", url)
 	}
-	logger.Debugf("Fetched IP %s from %s", ipDetails.IP, url)
-	return ipDetails.IP, nil
+	if err := s.checkFamily(ipDetails.IP); err != nil {
+		return ipDetails, err
+	}
+	logger.Debugf("Fetched IP %s from %s", ipDetails.IP, s)
+	return ipDetails, nil
+}
+
+// checkFamily rejects an answer of the wrong IP version, e.g. a dual-stack
+// service answering an IPv6 request with the IPv4 address.
+func (s HTTPSource) checkFamily(ip string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("%s returned %q, which is not an IP address", s, ip)
+	}
+	if !s.Binding.Family.matches(parsed) {
+		return fmt.Errorf("%s returned %s, which is not an %s address", s, ip, s.Binding.Family)
+	}
+	return nil
+}
+
+// ProbeResult is the outcome of querying one IP source.
+type ProbeResult struct {
+	Source  string
+	Details IPDetails
+	Latency time.Duration
+	Err     error
+}
+
+// Probe queries every source concurrently and returns the results in the order of sources.
+// Unlike GetCurrentIPFromSources it does not stop at the first success.
+func Probe(sources []Source, logger *logrus.Logger) []ProbeResult {
+	results := make([]ProbeResult, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source Source) {
+			defer wg.Done()
+			start := time.Now()
+			details, err := source.Fetch(logger)
+			results[i] = ProbeResult{Source: source.String(), Details: details, Latency: time.Since(start), Err: err}
+		}(i, source)
+	}
+	wg.Wait()
+	return results
+}
+
+// GetCurrentIPFromSources tries each source in order and returns the first IP obtained.
+func GetCurrentIPFromSources(sources []Source, logger *logrus.Logger) (string, error) {
+	var errs []error
+	for _, source := range sources {
+		details, err := source.Fetch(logger)
+		if err == nil {
+			return details.IP, nil
+		}
+		logger.Warnf("IP source %s failed: %v", source, err)
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no IP sources configured")
+	}
+	return "", errors.Join(errs...)
 }
@@ -0,0 +1,172 @@
+package ipfetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cloud providers for MetadataSource.
+const (
+	MetadataTencent = "tencent" // Tencent Cloud CVM
+	MetadataAWS     = "aws"     // AWS EC2, using IMDSv2
+	MetadataGCP     = "gcp"     // Google Compute Engine
+)
+
+// MetadataBaseURLs are the metadata service endpoints of each provider.
+var MetadataBaseURLs = map[string]string{
+	MetadataTencent: "http://metadata.tencentyun.com/latest",
+	MetadataAWS:     "http://169.254.169.254/latest",
+	MetadataGCP:     "http://metadata.google.internal/computeMetadata/v1",
+}
+
+// awsTokenTTL is the lifetime requested for IMDSv2 tokens, in seconds. A
+// token is only used for the lookup it was requested for.
+const awsTokenTTL = "60"
+
+// errNoMetadata marks a 404 from the metadata service, which is how the
+// providers report an instance without a public address.
+var errNoMetadata = errors.New("not found")
+
+// MetadataSource reads the instance's public address from the metadata
+// service of its cloud provider. This needs no internet access and is
+// never proxied.
+type MetadataSource struct {
+	Name     string // Set for [[ip_source]] tables and presets, shown in logs
+	Provider string // MetadataTencent, MetadataAWS or MetadataGCP
+	BaseURL  string // Overrides MetadataBaseURLs, e.g. for a local stand-in
+	Binding  Binding
+}
+
+func (s MetadataSource) String() string {
+	desc := s.Provider + " metadata"
+	if s.BaseURL != "" {
+		desc += " " + s.BaseURL
+	}
+	desc += s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+func (s MetadataSource) baseURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return MetadataBaseURLs[s.Provider]
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s MetadataSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	if _, ok := MetadataBaseURLs[s.Provider]; !ok {
+		return IPDetails{}, fmt.Errorf("%s: unknown provider %q", s, s.Provider)
+	}
+	family := s.Binding.Family
+	if family == AnyFamily {
+		family = IPv4
+	}
+	raw, err := s.lookup(family)
+	if errors.Is(err, errNoMetadata) {
+		return IPDetails{}, fmt.Errorf("%s: the instance has no public %s address", s, family)
+	}
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	// ipv6s lists one address per line; the first is the primary one.
+	line, _, _ := strings.Cut(strings.TrimSpace(raw), "\n")
+	if line == "" {
+		return IPDetails{}, fmt.Errorf("%s: the instance has no public %s address", s, family)
+	}
+	ip, err := parseAddress(line)
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("%s returned %w", s, err)
+	}
+	if !family.matches(ip) {
+		return IPDetails{}, fmt.Errorf("%s returned %s, which is not an %s address", s, ip, family)
+	}
+	if !isPublic(ip) {
+		return IPDetails{}, fmt.Errorf("%s returned %s, which is not a public address", s, ip)
+	}
+	logger.Debugf("Fetched IP %s from %s", ip, s)
+	return IPDetails{IP: ip.String()}, nil
+}
+
+// lookup returns the metadata value holding the public address of family.
+func (s MetadataSource) lookup(family Family) (string, error) {
+	client, err := s.Binding.lanClient()
+	if err != nil {
+		return "", err
+	}
+	base := s.baseURL()
+	header := http.Header{}
+
+	switch s.Provider {
+	case MetadataGCP:
+		header.Set("Metadata-Flavor", "Google")
+		path := "/instance/network-interfaces/0/access-configs/0/external-ip"
+		if family == IPv6 {
+			// ipv6s lists internal addresses; the external one has its own access config.
+			path = "/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6"
+		}
+		return metadataGet(client, http.MethodGet, base+path, header)
+	case MetadataAWS:
+		// IMDSv2: a session token from a PUT request authorizes the reads.
+		tokenHeader := http.Header{}
+		tokenHeader.Set("X-aws-ec2-metadata-token-ttl-seconds", awsTokenTTL)
+		token, err := metadataGet(client, http.MethodPut, base+"/api/token", tokenHeader)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// Answers to the PUT are dropped one hop too early in containers.
+			return "", fmt.Errorf("IMDSv2 token request timed out; in a container, the instance's metadata hop limit must be at least 2: %w", err)
+		}
+		if err != nil {
+			return "", fmt.Errorf("IMDSv2 token request failed: %v", err)
+		}
+		header.Set("X-aws-ec2-metadata-token", strings.TrimSpace(token))
+	}
+
+	// Tencent CVM uses the same layout as EC2.
+	if family == IPv4 {
+		return metadataGet(client, http.MethodGet, base+"/meta-data/public-ipv4", header)
+	}
+	mac, err := metadataGet(client, http.MethodGet, base+"/meta-data/mac", header)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the primary interface: %v", err)
+	}
+	return metadataGet(client, http.MethodGet, base+"/meta-data/network/interfaces/macs/"+strings.TrimSpace(mac)+"/ipv6s", header)
+}
+
+// metadataGet performs one request against the metadata service.
+func metadataGet(client *http.Client, method, url string, header http.Header) (string, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", fmt.Errorf("%w (is this a cloud instance?)", err)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errNoMetadata
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s: status code %d", method, url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
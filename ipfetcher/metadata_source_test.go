@@ -0,0 +1,119 @@
+package ipfetcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeMetadata serves values by path the way provider's metadata service
+// does, including the IMDSv2 token and the GCP Metadata-Flavor check.
+func fakeMetadata(t *testing.T, provider string, values map[string]string) MetadataSource {
+	t.Helper()
+	const token = "imds-token"
+	prefix := "/latest"
+	if provider == MetadataGCP {
+		prefix = "/computeMetadata/v1"
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := strings.CutPrefix(r.URL.Path, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch provider {
+		case MetadataAWS:
+			if path == "/api/token" {
+				if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+					http.Error(w, "bad token request", http.StatusBadRequest)
+					return
+				}
+				if v, ok := values[path]; ok {
+					http.Error(w, v, http.StatusForbidden)
+					return
+				}
+				fmt.Fprint(w, token)
+				return
+			}
+			if r.Header.Get("X-aws-ec2-metadata-token") != token {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		case MetadataGCP:
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+				return
+			}
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v, ok := values[path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, v)
+	}))
+	t.Cleanup(srv.Close)
+	return MetadataSource{Provider: provider, BaseURL: srv.URL + prefix}
+}
+
+func TestMetadataSource(t *testing.T) {
+	const mac = "52:54:00:12:34:56"
+	ec2Style := map[string]string{
+		"/meta-data/public-ipv4": "203.0.113.20",
+		"/meta-data/mac":         mac,
+		"/meta-data/network/interfaces/macs/" + mac + "/ipv6s": "2001:db8::20\n2001:db8::21\n",
+	}
+	tests := []struct {
+		name     string
+		provider string
+		family   Family
+		values   map[string]string
+		want     string
+		wantErr  string
+	}{
+		{name: "tencent IPv4", provider: MetadataTencent, family: IPv4, values: ec2Style, want: "203.0.113.20"},
+		{name: "tencent IPv6", provider: MetadataTencent, family: IPv6, values: ec2Style, want: "2001:db8::20"},
+		{name: "tencent without public address", provider: MetadataTencent, family: IPv4,
+			values: map[string]string{}, wantErr: "the instance has no public IPv4 address"},
+		{name: "tencent private address", provider: MetadataTencent, family: IPv4,
+			values: map[string]string{"/meta-data/public-ipv4": "10.0.0.5"}, wantErr: "not a public address"},
+
+		{name: "aws IPv4", provider: MetadataAWS, family: IPv4, values: ec2Style, want: "203.0.113.20"},
+		{name: "aws IPv6", provider: MetadataAWS, family: IPv6, values: ec2Style, want: "2001:db8::20"},
+		{name: "aws default family", provider: MetadataAWS, values: ec2Style, want: "203.0.113.20"},
+		{name: "aws token refused", provider: MetadataAWS, family: IPv4,
+			values: map[string]string{"/api/token": "IMDSv2 disabled"}, wantErr: "IMDSv2 token request failed"},
+		{name: "aws without IPv6", provider: MetadataAWS, family: IPv6,
+			values: map[string]string{"/meta-data/mac": mac}, wantErr: "the instance has no public IPv6 address"},
+
+		{name: "gcp IPv4", provider: MetadataGCP, family: IPv4, values: map[string]string{
+			"/instance/network-interfaces/0/access-configs/0/external-ip": "203.0.113.30",
+		}, want: "203.0.113.30"},
+		{name: "gcp IPv6", provider: MetadataGCP, family: IPv6, values: map[string]string{
+			"/instance/network-interfaces/0/ipv6s":                               "fd20::5",
+			"/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6": "2001:db8::30",
+		}, want: "2001:db8::30"},
+		{name: "gcp without external address", provider: MetadataGCP, family: IPv4,
+			values: map[string]string{}, wantErr: "the instance has no public IPv4 address"},
+		{name: "gcp wrong family", provider: MetadataGCP, family: IPv6, values: map[string]string{
+			"/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6": "203.0.113.30",
+		}, wantErr: "not an IPv6 address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := fakeMetadata(t, tt.provider, tt.values)
+			src.Binding = Binding{Family: tt.family}
+			checkFetch(t, src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestMetadataSourceUnknownProvider(t *testing.T) {
+	checkFetch(t, MetadataSource{Provider: "azure"}, "", `unknown provider "azure"`)
+}
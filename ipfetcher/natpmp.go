@@ -0,0 +1,180 @@
+package ipfetcher
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// NAT-PMP (RFC 6886) and PCP (RFC 6887) share port 5351 and a retransmission
+// scheme: start at 250ms and double, as both RFCs recommend.
+const natpmpInitialTimeout = 250 * time.Millisecond
+
+// PCP constants.
+const (
+	pcpVersion        = 2
+	pcpOpMap          = 1
+	pcpResponseBit    = 0x80
+	pcpMapLifetime    = 120 // Seconds; the mapping is deleted right after
+	pcpHeaderSize     = 24
+	pcpMapPayloadSize = 36
+)
+
+var natpmpResults = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+var pcpResults = map[byte]string{
+	1:  "unsupported version",
+	2:  "not authorized",
+	3:  "malformed request",
+	4:  "unsupported opcode",
+	5:  "unsupported option",
+	6:  "malformed option",
+	7:  "network failure",
+	8:  "no resources",
+	9:  "unsupported protocol",
+	10: "user exceeded quota",
+	11: "cannot provide external address",
+	12: "address mismatch",
+	13: "excessive remote peers",
+}
+
+// fetchNATPMP sends a NAT-PMP external address request.
+func (s RouterSource) fetchNATPMP() (net.IP, error) {
+	conn, err := s.dialGateway()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := natpmpExchange(conn, []byte{0, 0}, func(b []byte) bool {
+		return len(b) >= 12 && b[0] == 0 && b[1] == 128
+	})
+	if err != nil {
+		return nil, err
+	}
+	if code := binary.BigEndian.Uint16(resp[2:]); code != 0 {
+		return nil, fmt.Errorf("router returned result %d (%s)", code, natpmpResults[code])
+	}
+	return net.IP(append([]byte(nil), resp[8:12]...)), nil
+}
+
+// fetchPCP sends a PCP MAP request for the local UDP socket and reads the
+// assigned external address. PCP has no request for the address alone, so
+// the short-lived mapping is deleted again afterwards.
+func (s RouterSource) fetchPCP() (net.IP, error) {
+	conn, err := s.dialGateway()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr)
+
+	var nonce [12]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	request := pcpMapRequest(local, nonce, pcpMapLifetime)
+	resp, err := natpmpExchange(conn, request, func(b []byte) bool {
+		// A NAT-PMP-only router answers with a version 0 error.
+		return len(b) >= 4 && b[0] == 0 || len(b) >= pcpHeaderSize && b[0] == pcpVersion && b[1] == pcpResponseBit|pcpOpMap
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] != pcpVersion {
+		return nil, fmt.Errorf("router only supports NAT-PMP; use natpmp")
+	}
+	if code := resp[3]; code != 0 {
+		return nil, fmt.Errorf("router returned result %d (%s)", code, pcpResults[code])
+	}
+	if len(resp) < pcpHeaderSize+pcpMapPayloadSize || string(resp[pcpHeaderSize:pcpHeaderSize+12]) != string(nonce[:]) {
+		return nil, fmt.Errorf("malformed MAP response")
+	}
+	external := net.IP(append([]byte(nil), resp[pcpHeaderSize+20:pcpHeaderSize+36]...))
+	if v4 := external.To4(); v4 != nil {
+		external = v4
+	}
+
+	// Best effort: the mapping expires on its own if this is lost.
+	conn.Write(pcpMapRequest(local, nonce, 0))
+	return external, nil
+}
+
+// pcpMapRequest builds a MAP request for UDP on local's port.
+func pcpMapRequest(local *net.UDPAddr, nonce [12]byte, lifetime uint32) []byte {
+	req := make([]byte, pcpHeaderSize+pcpMapPayloadSize)
+	req[0] = pcpVersion
+	req[1] = pcpOpMap
+	binary.BigEndian.PutUint32(req[4:], lifetime)
+	copy(req[8:24], local.IP.To16()) // IPv4 addresses are sent IPv4-mapped
+	payload := req[pcpHeaderSize:]
+	copy(payload[0:12], nonce[:])
+	payload[12] = 17 // UDP
+	binary.BigEndian.PutUint16(payload[16:], uint16(local.Port))
+	binary.BigEndian.PutUint16(payload[18:], uint16(local.Port)) // Suggested external port
+	// Suggested external address: all zeros (IPv6) or ::ffff:0.0.0.0 (IPv4).
+	if local.IP.To4() != nil {
+		payload[30], payload[31] = 0xff, 0xff
+	}
+	return req
+}
+
+// dialGateway opens a UDP socket to the NAT-PMP/PCP server.
+func (s RouterSource) dialGateway() (net.Conn, error) {
+	addr, err := s.gateway()
+	if err != nil {
+		return nil, err
+	}
+	dial, err := s.Binding.dial()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), routerTimeout)
+	defer cancel()
+	return dial(ctx, "udp", addr)
+}
+
+// natpmpExchange sends request until a packet accepted by match arrives,
+// doubling the wait each time, within routerTimeout.
+func natpmpExchange(conn net.Conn, request []byte, match func([]byte) bool) ([]byte, error) {
+	deadline := time.Now().Add(routerTimeout)
+	wait := natpmpInitialTimeout
+	buf := make([]byte, 1100) // Maximum PCP message size
+	for {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		readUntil := time.Now().Add(wait)
+		if readUntil.After(deadline) {
+			readUntil = deadline
+		}
+		conn.SetReadDeadline(readUntil)
+		for {
+			n, err := conn.Read(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if match(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("no response within %s", routerTimeout)
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,242 @@
+package ipfetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PageSource reads the WAN address from a page on the LAN, typically a
+// router's status page or JSON API. Requests go straight to the page,
+// never through the IP detection proxy.
+type PageSource struct {
+	Name     string // Set for [[ip_source]] tables, shown in logs
+	URL      string
+	Username string            // HTTP basic authentication, if set
+	Password string            // Never logged
+	Headers  map[string]string // e.g. a Cookie or Authorization header
+	// JSONPath selects the address in a JSON answer, e.g. "wan.ipv4[0].address";
+	// Regex matches it in any other answer, using the first group if there
+	// is one. With neither, the whole answer must be the address.
+	JSONPath string
+	Regex    string
+	Binding  Binding
+}
+
+func (s PageSource) String() string {
+	desc := "page " + s.URL + s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s PageSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	ip, err := s.fetch()
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	if err := checkWANAddress(s, s.Binding.Family, ip); err != nil {
+		return IPDetails{}, err
+	}
+	logger.Debugf("Fetched IP %s from %s", ip, s)
+	return IPDetails{IP: ip.String()}, nil
+}
+
+func (s PageSource) fetch() (net.IP, error) {
+	client, err := s.Binding.lanClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("status code %d (check username, password and headers)", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return extractIP(body, s.JSONPath, s.Regex)
+}
+
+// extractIP finds the address in body by JSON path, by regular expression,
+// or as the whole body.
+func extractIP(body []byte, jsonPath, pattern string) (net.IP, error) {
+	var raw string
+	switch {
+	case jsonPath != "":
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, fmt.Errorf("answer is not JSON: %w", err)
+		}
+		value, err := lookupJSONPath(doc, jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is %v, not a string", jsonPath, value)
+		}
+		raw = str
+	case pattern != "":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		match := re.FindSubmatch(body)
+		if match == nil {
+			return nil, fmt.Errorf("regex %q does not match the answer", pattern)
+		}
+		raw = string(match[0])
+		if len(match) > 1 {
+			raw = string(match[1])
+		}
+	default:
+		raw = string(body)
+	}
+	return parseAddress(raw)
+}
+
+// parseAddress accepts an address, optionally with a prefix length as
+// routers often show it (192.0.2.1/24).
+func parseAddress(raw string) (net.IP, error) {
+	raw = strings.TrimSpace(raw)
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		if cidrIP, _, err := net.ParseCIDR(raw); err == nil {
+			ip = cidrIP
+		}
+	}
+	if ip == nil {
+		if len(raw) > 64 {
+			raw = raw[:64] + "..."
+		}
+		return nil, fmt.Errorf("%q is not an IP address", raw)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip, nil
+}
+
+// CheckJSONPath reports whether path is valid for the json_path option.
+func CheckJSONPath(path string) error {
+	_, err := parseJSONPath(path)
+	return err
+}
+
+// lookupJSONPath returns the value at path in a decoded JSON document. The
+// path is a dot-separated list of keys with optional [index] suffixes, such
+// as "values[0].ipaddr"; a leading "$." is allowed.
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	value := doc
+	walked := "$"
+	for _, step := range steps {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if step.index >= 0 {
+				return nil, fmt.Errorf("%s is an object, not an array", walked)
+			}
+			next, ok := v[step.key]
+			if !ok {
+				return nil, fmt.Errorf("%s has no key %q", walked, step.key)
+			}
+			value, walked = next, walked+"."+step.key
+		case []interface{}:
+			if step.index < 0 {
+				return nil, fmt.Errorf("%s is an array, not an object", walked)
+			}
+			if step.index >= len(v) {
+				return nil, fmt.Errorf("%s has %d elements, no [%d]", walked, len(v), step.index)
+			}
+			value, walked = v[step.index], walked+"["+strconv.Itoa(step.index)+"]"
+		default:
+			return nil, fmt.Errorf("%s is %v, which has no members", walked, value)
+		}
+	}
+	return value, nil
+}
+
+type jsonPathStep struct {
+	key   string
+	index int // -1 for object keys
+}
+
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty JSON path")
+	}
+	var steps []jsonPathStep
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []int
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			for rest := part[i:]; rest != ""; {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("invalid JSON path %q: malformed index in %q", path, part)
+				}
+				n, err := strconv.Atoi(rest[1:end])
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid JSON path %q: bad index in %q", path, part)
+				}
+				indexes = append(indexes, n)
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" && len(indexes) == 0 {
+			return nil, fmt.Errorf("invalid JSON path %q: empty key", path)
+		}
+		if key != "" {
+			steps = append(steps, jsonPathStep{key: key, index: -1})
+		}
+		for _, n := range indexes {
+			steps = append(steps, jsonPathStep{index: n})
+		}
+	}
+	return steps, nil
+}
+
+// checkWANAddress rejects an address reported by the router that is of the
+// wrong family or not public.
+func checkWANAddress(source fmt.Stringer, family Family, ip net.IP) error {
+	if !family.matches(ip) {
+		return fmt.Errorf("%s reported %s, which is not an %s address", source, ip, family)
+	}
+	if !isPublic(ip) {
+		// Publishing the WAN address of a router behind another NAT would be wrong.
+		return fmt.Errorf("%s reported %s, which is not a public address (is the router behind another NAT?)", source, ip)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ipfetcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string // Steps as key or [index], joined by spaces
+		wantErr string
+	}{
+		{path: "ip", want: "ip"},
+		{path: "$.ip", want: "ip"},
+		{path: ".ip", want: "ip"},
+		{path: "wan.ipv4[0].address", want: "wan ipv4 [0] address"},
+		{path: "$.values[1]", want: "values [1]"},
+		{path: "[0]", want: "[0]"},
+		{path: "a[0][2].b", want: "a [0] [2] b"},
+		{path: "", wantErr: "empty JSON path"},
+		{path: "$", wantErr: "empty JSON path"},
+		{path: "a[", wantErr: "malformed index"},
+		{path: "a[0", wantErr: "malformed index"},
+		{path: "a[0]b", wantErr: "malformed index"},
+		{path: "a[-1]", wantErr: "bad index"},
+		{path: "a[x]", wantErr: "bad index"},
+		{path: "a[]", wantErr: "bad index"},
+		{path: "a..b", wantErr: "empty key"},
+		{path: "a.", wantErr: "empty key"},
+	}
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseJSONPath(%q) = %v, %v; want error %q", tt.path, steps, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseJSONPath(%q) error = %v", tt.path, err)
+			continue
+		}
+		var got []string
+		for _, step := range steps {
+			if step.index >= 0 {
+				got = append(got, fmt.Sprintf("[%d]", step.index))
+			} else {
+				got = append(got, step.key)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("parseJSONPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtractIP(t *testing.T) {
+	const doc = `{"wan":{"up":true,"ipv4":[{"address":"203.0.113.7/24"}],"mtu":1492,"ipv6":null},"list":["192.0.2.1","2001:db8::1"]}`
+	tests := []struct {
+		name, body, jsonPath, regex string
+		want                        string
+		wantErr                     string
+	}{
+		{name: "JSON path", body: doc, jsonPath: "wan.ipv4[0].address", want: "203.0.113.7"},
+		{name: "JSON path with $", body: doc, jsonPath: "$.list[1]", want: "2001:db8::1"},
+		{name: "root array", body: `["198.51.100.2"]`, jsonPath: "[0]", want: "198.51.100.2"},
+		{name: "missing key", body: doc, jsonPath: "wan.ipv4[0].addr", wantErr: `$.wan.ipv4[0] has no key "addr"`},
+		{name: "index out of range", body: doc, jsonPath: "list[2]", wantErr: "$.list has 2 elements, no [2]"},
+		{name: "index on object", body: doc, jsonPath: "wan[0]", wantErr: "$.wan is an object, not an array"},
+		{name: "key on array", body: doc, jsonPath: "list.first", wantErr: "$.list is an array, not an object"},
+		{name: "key on scalar", body: doc, jsonPath: "wan.mtu.value", wantErr: "$.wan.mtu is 1492, which has no members"},
+		{name: "key on null", body: doc, jsonPath: "wan.ipv6.address", wantErr: "$.wan.ipv6 is <nil>"},
+		{name: "not a string", body: doc, jsonPath: "wan.up", wantErr: "wan.up is true, not a string"},
+		{name: "object value", body: doc, jsonPath: "wan", wantErr: "not a string"},
+		{name: "malformed path", body: doc, jsonPath: "a[", wantErr: "malformed index"},
+		{name: "not JSON", body: "<html>", jsonPath: "ip", wantErr: "answer is not JSON"},
+		{name: "regex group", body: `<td>WAN IP</td><td>203.0.113.9</td>`, regex: `WAN IP</td><td>([0-9.]+)<`, want: "203.0.113.9"},
+		{name: "regex without group", body: `addr=203.0.113.9;`, regex: `[0-9]+(?:\.[0-9]+){3}`, want: "203.0.113.9"},
+		{name: "regex no match", body: `offline`, regex: `([0-9.]+)`, wantErr: "does not match the answer"},
+		{name: "invalid regex", body: `x`, regex: `(`, wantErr: "missing closing )"},
+		{name: "whole body", body: " 203.0.113.10/32\n", want: "203.0.113.10"},
+		{name: "whole body not an address", body: "error", wantErr: `"error" is not an IP address`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := extractIP([]byte(tt.body), tt.jsonPath, tt.regex)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("extractIP() = %v, %v; want error %q", ip, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || ip.String() != tt.want {
+				t.Errorf("extractIP() = %v, %v; want %s", ip, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "pw" || r.Header.Get("X-Token") != "t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"wan":{"ip":"203.0.113.7"},"lan":{"ip":"192.168.1.1"}}`)
+	}))
+	defer srv.Close()
+
+	src := PageSource{URL: srv.URL, Username: "admin", Password: "pw", Headers: map[string]string{"X-Token": "t"}, JSONPath: "wan.ip"}
+	checkFetch(t, src, "203.0.113.7", "")
+
+	lan := src
+	lan.JSONPath = "lan.ip"
+	checkFetch(t, lan, "", "not a public address")
+
+	wrong := src
+	wrong.Password = "wrong"
+	checkFetch(t, wrong, "", "status code 401 (check username, password and headers)")
+}
@@ -0,0 +1,42 @@
+package ipfetcher
+
+import "strings"
+
+// Presets names the built-in sources usable in IP_SOURCES_* by name.
+var Presets = []string{"opendns", "google-dns", "stun", "upnp", "natpmp", "pcp", "tencent-metadata", "aws-metadata", "gcp-metadata"}
+
+// Preset returns the built-in source called name, using binding:
+// "opendns" (myip.opendns.com), "google-dns" (o-o.myaddr.l.google.com TXT)
+// "stun" (public STUN servers of Google and Cloudflare), "upnp", "natpmp"
+// and "pcp", which ask the router found on the local network, or
+// "tencent-metadata", "aws-metadata" and "gcp-metadata" for cloud instances.
+func Preset(name string, binding Binding) (Source, bool) {
+	v6 := binding.Family == IPv6
+	switch name {
+	case "opendns":
+		src := DNSSource{Name: name, QueryName: "myip.opendns.com", Binding: binding,
+			Resolvers: []string{"208.67.222.222", "208.67.220.220"}}
+		if v6 {
+			src.Resolvers = []string{"2620:119:35::35", "2620:119:53::53"}
+		}
+		return src, true
+	case "google-dns":
+		// Google's authoritative servers, since a recursive resolver would
+		// report its own address.
+		src := DNSSource{Name: name, QueryName: "o-o.myaddr.l.google.com", QueryType: "TXT", Binding: binding,
+			Resolvers: []string{"216.239.32.10", "216.239.34.10"}}
+		if v6 {
+			src.Resolvers = []string{"2001:4860:4802:32::a", "2001:4860:4802:34::a"}
+		}
+		return src, true
+	case "stun":
+		// Both names have A and AAAA records; the binding's family picks one.
+		return STUNSource{Name: name, Servers: []string{"stun.l.google.com:19302", "stun.cloudflare.com:3478"}, Binding: binding}, true
+	case RouterUPnP, RouterNATPMP, RouterPCP:
+		return RouterSource{Name: name, Protocol: name, Binding: binding}, true
+	case "tencent-metadata", "aws-metadata", "gcp-metadata":
+		return MetadataSource{Name: name, Provider: strings.TrimSuffix(name, "-metadata"), Binding: binding}, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,131 @@
+package ipfetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Protocols for RouterSource.
+const (
+	RouterUPnP   = "upnp"   // UPnP IGD GetExternalIPAddress, found via SSDP
+	RouterNATPMP = "natpmp" // NAT-PMP (RFC 6886) external address request
+	RouterPCP    = "pcp"    // PCP (RFC 6887) MAP request
+)
+
+// routerTimeout bounds one exchange with the router. It is a variable so
+// tests can shorten it.
+var routerTimeout = 3 * time.Second
+
+// RouterSource asks the home router for its WAN address. It is the most
+// accurate source behind a consumer router and needs no internet service.
+type RouterSource struct {
+	Name     string // Set for [[ip_source]] tables and presets, shown in logs
+	Protocol string // RouterUPnP, RouterNATPMP or RouterPCP
+
+	// Gateway is the NAT-PMP/PCP server, host or host:port (5351 by
+	// default). Empty means the default gateway, found on Linux only.
+	Gateway string
+	// ControlURL is the UPnP WANIPConnection control URL; set it to skip
+	// SSDP discovery.
+	ControlURL string
+	// SSDPAddress is where UPnP discovery is sent; empty means the
+	// 239.255.255.250:1900 multicast group.
+	SSDPAddress string
+
+	Binding Binding
+}
+
+func (s RouterSource) String() string {
+	desc := s.Protocol
+	switch {
+	case s.ControlURL != "":
+		desc += " " + s.ControlURL
+	case s.SSDPAddress != "":
+		desc += " via " + s.SSDPAddress
+	case s.Gateway != "":
+		desc += " " + s.Gateway
+	}
+	desc += s.Binding.String()
+	if s.Name != "" && s.Name != s.Protocol {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s RouterSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	var ip net.IP
+	var err error
+	switch s.Protocol {
+	case RouterUPnP:
+		if s.Binding.Family == IPv6 {
+			return IPDetails{}, fmt.Errorf("%s: UPnP IGD only reports IPv4 addresses", s)
+		}
+		ip, err = s.fetchUPnP(logger)
+	case RouterNATPMP:
+		if s.Binding.Family == IPv6 {
+			return IPDetails{}, fmt.Errorf("%s: NAT-PMP only reports IPv4 addresses; use pcp", s)
+		}
+		ip, err = s.fetchNATPMP()
+	case RouterPCP:
+		ip, err = s.fetchPCP()
+	default:
+		err = fmt.Errorf("unknown protocol %q", s.Protocol)
+	}
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	if err := checkWANAddress(s, s.Binding.Family, ip); err != nil {
+		return IPDetails{}, err
+	}
+	logger.Debugf("Fetched IP %s from %s", ip, s)
+	return IPDetails{IP: ip.String()}, nil
+}
+
+// gateway returns the NAT-PMP/PCP server address with port.
+func (s RouterSource) gateway() (string, error) {
+	gw := s.Gateway
+	if gw == "" {
+		var err error
+		if gw, err = DefaultGateway(s.Binding.Family, s.Binding.Interface); err != nil {
+			return "", err
+		}
+	}
+	if _, _, err := net.SplitHostPort(gw); err == nil {
+		return gw, nil
+	}
+	return net.JoinHostPort(strings.Trim(gw, "[]"), "5351"), nil
+}
+
+// lanClient returns an HTTP client for talking to the router: bound like b,
+// and never proxied. b.Family selects the address the router reports, not
+// how the router is reached, so the router's IPv4 LAN address also serves
+// IPv6 lookups.
+func (b Binding) lanClient() (*http.Client, error) {
+	b.Family = AnyFamily
+	dial, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dial(ctx, "tcp", addr)
+	}
+	transport.DisableKeepAlives = true
+	return &http.Client{Timeout: routerTimeout, Transport: transport}, nil
+}
+
+// cgnat is the shared address space of RFC 6598, used by carrier-grade NAT.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// isPublic reports whether ip is a globally routable unicast address.
+func isPublic(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnat.Contains(ip)
+}
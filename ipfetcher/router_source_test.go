@@ -0,0 +1,277 @@
+package ipfetcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return l
+}
+
+// shortRouterTimeout keeps the timeout cases fast.
+func shortRouterTimeout(t *testing.T) {
+	old := routerTimeout
+	routerTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { routerTimeout = old })
+}
+
+// fakeUDPServer answers each datagram with reply(request); a nil reply sends
+// nothing. It records the requests it received.
+type fakeUDPServer struct {
+	conn     net.PacketConn
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+func newFakeUDPServer(t *testing.T, reply func(req []byte) []byte) *fakeUDPServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeUDPServer{conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			s.mu.Lock()
+			s.requests = append(s.requests, req)
+			s.mu.Unlock()
+			if resp := reply(req); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *fakeUDPServer) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *fakeUDPServer) received() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.requests...)
+}
+
+// natpmpReply builds a NAT-PMP external address response.
+func natpmpReply(code uint16, ip string) []byte {
+	resp := make([]byte, 12)
+	resp[1] = 128
+	binary.BigEndian.PutUint16(resp[2:], code)
+	copy(resp[8:], net.ParseIP(ip).To4())
+	return resp
+}
+
+// pcpReply answers a PCP MAP request, echoing its nonce.
+func pcpReply(req []byte, code byte, ip string) []byte {
+	resp := make([]byte, pcpHeaderSize+pcpMapPayloadSize)
+	resp[0] = pcpVersion
+	resp[1] = pcpResponseBit | pcpOpMap
+	resp[3] = code
+	copy(resp[pcpHeaderSize:], req[pcpHeaderSize:pcpHeaderSize+12])
+	resp[pcpHeaderSize+12] = 17
+	copy(resp[pcpHeaderSize+20:], net.ParseIP(ip).To16())
+	return resp
+}
+
+func TestRouterSourceNATPMP(t *testing.T) {
+	shortRouterTimeout(t)
+	tests := []struct {
+		name    string
+		reply   func(req []byte) []byte
+		want    string
+		wantErr string
+	}{
+		{"success", func([]byte) []byte { return natpmpReply(0, "203.0.113.9") }, "203.0.113.9", ""},
+		{"result code", func([]byte) []byte { return natpmpReply(2, "0.0.0.0") }, "", "result 2 (not authorized)"},
+		{"private address", func([]byte) []byte { return natpmpReply(0, "192.168.1.2") }, "", "not a public address"},
+		{"carrier-grade NAT", func([]byte) []byte { return natpmpReply(0, "100.64.1.2") }, "", "not a public address"},
+		{"ignores stray packets", func(req []byte) []byte {
+			if len(req) == 2 {
+				return []byte{0, 129, 0, 0} // A response to another opcode
+			}
+			return nil
+		}, "", "no response within"},
+		{"timeout", func([]byte) []byte { return nil }, "", "no response within"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeUDPServer(t, tt.reply)
+			src := RouterSource{Protocol: RouterNATPMP, Gateway: gw.addr(), Binding: Binding{Family: IPv4}}
+			checkFetch(t, src, tt.want, tt.wantErr)
+			if reqs := gw.received(); len(reqs) == 0 || string(reqs[0]) != "\x00\x00" {
+				t.Errorf("requests = %x, want an external address request", reqs)
+			}
+		})
+	}
+}
+
+func TestRouterSourceNATPMPRejectsIPv6(t *testing.T) {
+	src := RouterSource{Protocol: RouterNATPMP, Gateway: "127.0.0.1:1", Binding: Binding{Family: IPv6}}
+	checkFetch(t, src, "", "only reports IPv4")
+}
+
+func TestRouterSourcePCP(t *testing.T) {
+	shortRouterTimeout(t)
+	tests := []struct {
+		name    string
+		reply   func(req []byte) []byte
+		want    string
+		wantErr string
+	}{
+		{"success", func(req []byte) []byte { return pcpReply(req, 0, "203.0.113.10") }, "203.0.113.10", ""},
+		{"result code", func(req []byte) []byte { return pcpReply(req, 8, "::") }, "", "result 8 (no resources)"},
+		{"NAT-PMP only", func([]byte) []byte { return []byte{0, 129, 0, 1} }, "", "only supports NAT-PMP"},
+		{"wrong nonce", func(req []byte) []byte {
+			resp := pcpReply(req, 0, "203.0.113.10")
+			resp[pcpHeaderSize] ^= 0xff
+			return resp
+		}, "", "malformed MAP response"},
+		{"timeout", func([]byte) []byte { return nil }, "", "no response within"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newFakeUDPServer(t, tt.reply)
+			src := RouterSource{Protocol: RouterPCP, Gateway: gw.addr(), Binding: Binding{Family: IPv4}}
+			checkFetch(t, src, tt.want, tt.wantErr)
+
+			reqs := gw.received()
+			if len(reqs) == 0 {
+				t.Fatal("no request received")
+			}
+			req := reqs[0]
+			if len(req) != pcpHeaderSize+pcpMapPayloadSize || req[0] != pcpVersion || req[1] != pcpOpMap {
+				t.Fatalf("first request %x is not a PCP MAP request", req)
+			}
+			if lifetime := binary.BigEndian.Uint32(req[4:]); lifetime != pcpMapLifetime {
+				t.Errorf("lifetime = %d, want %d", lifetime, pcpMapLifetime)
+			}
+			if tt.wantErr == "" {
+				// The mapping is deleted again with a zero lifetime.
+				deadline := time.Now().Add(time.Second)
+				for len(reqs) < 2 && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+					reqs = gw.received()
+				}
+				if len(reqs) < 2 || binary.BigEndian.Uint32(reqs[len(reqs)-1][4:]) != 0 {
+					t.Errorf("mapping was not deleted: requests %x", reqs)
+				}
+			}
+		})
+	}
+}
+
+// fakeIGD serves a device description and a WANIPConnection control URL.
+func fakeIGD(t *testing.T, soapStatus int, soapBody string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><root xmlns="urn:schemas-upnp-org:device-1-0"><device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device><deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service><serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<controlURL>/ctl/IPConn</controlURL></service></serviceList>
+</device></deviceList></device></deviceList></device></root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(soapStatus)
+		fmt.Fprint(w, soapBody)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func soapExternalIP(ip string) string {
+	return `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">` +
+		`<NewExternalIPAddress>` + ip + `</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`
+}
+
+const soapFault = `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>` +
+	`<faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>` +
+	`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>501</errorCode><errorDescription>Action Failed</errorDescription></UPnPError>` +
+	`</detail></s:Fault></s:Body></s:Envelope>`
+
+func TestRouterSourceUPnP(t *testing.T) {
+	shortRouterTimeout(t)
+	tests := []struct {
+		name       string
+		soapStatus int
+		soapBody   string
+		ssdp       bool // Discover via SSDP rather than a configured control URL
+		ssdpSilent bool
+		want       string
+		wantErr    string
+	}{
+		{name: "discovery", soapStatus: 200, soapBody: soapExternalIP("203.0.113.11"), ssdp: true, want: "203.0.113.11"},
+		{name: "control URL", soapStatus: 200, soapBody: soapExternalIP("203.0.113.11"), want: "203.0.113.11"},
+		{name: "UPnP error", soapStatus: 500, soapBody: soapFault, wantErr: "UPnP error 501 (Action Failed)"},
+		{name: "WAN down", soapStatus: 200, soapBody: soapExternalIP("0.0.0.0"), wantErr: "router has no WAN address"},
+		{name: "double NAT", soapStatus: 200, soapBody: soapExternalIP("10.0.0.2"), wantErr: "not a public address"},
+		{name: "no gateway answers", ssdp: true, ssdpSilent: true, wantErr: "no UPnP gateway answered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			igd := fakeIGD(t, tt.soapStatus, tt.soapBody)
+			src := RouterSource{Protocol: RouterUPnP, Binding: Binding{Family: IPv4}}
+			if tt.ssdp {
+				ssdp := newFakeUDPServer(t, func(req []byte) []byte {
+					if tt.ssdpSilent || !strings.HasPrefix(string(req), "M-SEARCH * HTTP/1.1\r\n") {
+						return nil
+					}
+					// Answer only the search for WANIPConnection, as some routers do.
+					if !strings.Contains(string(req), "ST: urn:schemas-upnp-org:service:WANIPConnection:1\r\n") {
+						return nil
+					}
+					return []byte("HTTP/1.1 200 OK\r\nST: urn:schemas-upnp-org:service:WANIPConnection:1\r\n" +
+						"LOCATION: " + igd.URL + "/desc.xml\r\n\r\n")
+				})
+				src.SSDPAddress = ssdp.addr()
+			} else {
+				src.ControlURL = igd.URL + "/ctl/IPConn"
+			}
+			checkFetch(t, src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func checkFetch(t *testing.T, src Source, want, wantErr string) {
+	t.Helper()
+	details, err := src.Fetch(testLogger())
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("Fetch() error = %v, want it to contain %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if details.IP != want {
+		t.Errorf("Fetch() IP = %s, want %s", details.IP, want)
+	}
+}
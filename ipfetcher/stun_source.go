@@ -0,0 +1,248 @@
+package ipfetcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// STUN (RFC 5389) message constants.
+const (
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunBindingError         = 0x0111
+	stunMagicCookie          = 0x2112A442
+	stunAttrMappedAddress    = 0x0001
+	stunAttrErrorCode        = 0x0009
+	stunAttrXORMappedAddress = 0x0020
+	stunAttrXORMappedOld     = 0x8020 // Used by some pre-RFC 5389 servers
+	stunHeaderSize           = 20
+)
+
+// stunTimeout bounds the exchange with each server; requests are
+// retransmitted every stunRetransmit until then, as UDP may drop them.
+var stunTimeout = 3 * time.Second
+
+const stunRetransmit = 500 * time.Millisecond
+
+// DefaultSTUNPort is used for servers given without a port.
+const DefaultSTUNPort = "3478"
+
+// STUNSource sends a STUN binding request, which works behind NAT where
+// HTTP egress is blocked but UDP is open. The answer is the NAT mapping of
+// the request's socket, reported in IPDetails.NATMapping.
+type STUNSource struct {
+	Name    string   // Set for [[ip_source]] tables and presets, shown in logs
+	Servers []string // host or host:port, tried in order; DefaultSTUNPort by default
+	Binding Binding
+}
+
+func (s STUNSource) String() string {
+	desc := "stun:" + strings.Join(s.Servers, ",") + s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+// Fetch implements Source. IP and NATMapping are filled.
+func (s STUNSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	if len(s.Servers) == 0 {
+		return IPDetails{}, fmt.Errorf("%s: no servers configured", s)
+	}
+	dial, err := s.Binding.dial()
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("%s: %w", s, err)
+	}
+
+	var errs []string
+	for _, server := range s.Servers {
+		addr := server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			addr = net.JoinHostPort(strings.Trim(server, "[]"), DefaultSTUNPort)
+		}
+		local, mapped, err := stunBinding(dial, addr)
+		if err != nil {
+			logger.Debugf("STUN request to %s failed: %v", addr, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+			continue
+		}
+		if !s.Binding.Family.matches(mapped.IP) {
+			errs = append(errs, fmt.Sprintf("%s: mapped address %s is not an %s address", addr, mapped.IP, s.Binding.Family))
+			continue
+		}
+		details := IPDetails{IP: mapped.IP.String(), NATMapping: describeMapping(local, mapped)}
+		logger.Debugf("Fetched IP %s from %s, %s", details.IP, s, details.NATMapping)
+		return details, nil
+	}
+	return IPDetails{}, fmt.Errorf("failed to get IP from %s: %s", s, strings.Join(errs, "; "))
+}
+
+// describeMapping reports how the NAT translated the request's socket.
+func describeMapping(local, mapped *net.UDPAddr) string {
+	switch {
+	case local == nil:
+		return "mapped to " + mapped.String()
+	case local.IP.Equal(mapped.IP) && local.Port == mapped.Port:
+		return "no NAT (" + mapped.String() + ")"
+	case local.Port == mapped.Port:
+		return local.String() + " -> " + mapped.String() + " (port preserved)"
+	default:
+		return local.String() + " -> " + mapped.String()
+	}
+}
+
+// stunBinding performs one binding request against addr and returns the
+// local address used and the server-reflexive (mapped) address.
+func stunBinding(dial func(ctx context.Context, network, addr string) (net.Conn, error), addr string) (local, mapped *net.UDPAddr, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), stunTimeout)
+	defer cancel()
+	conn, err := dial(ctx, "udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	local, _ = conn.LocalAddr().(*net.UDPAddr)
+
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return nil, nil, err
+	}
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	copy(request[8:], txID[:])
+
+	deadline, _ := ctx.Deadline()
+	buf := make([]byte, 1500)
+	for {
+		if _, err := conn.Write(request); err != nil {
+			return nil, nil, err
+		}
+		wait := time.Now().Add(stunRetransmit)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		n, err := conn.Read(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			if time.Now().Before(deadline) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("no response within %s", stunTimeout)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		mapped, err := parseSTUNResponse(buf[:n], txID)
+		if errors.Is(err, errSTUNIgnored) {
+			continue // A stray or late packet; keep waiting for ours.
+		}
+		return local, mapped, err
+	}
+}
+
+// errSTUNIgnored marks packets that are not the response to our request.
+var errSTUNIgnored = errors.New("not a response to this request")
+
+// parseSTUNResponse extracts the mapped address from a binding response.
+func parseSTUNResponse(msg []byte, txID [12]byte) (*net.UDPAddr, error) {
+	if len(msg) < stunHeaderSize || binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie || !bytes.Equal(msg[8:20], txID[:]) {
+		return nil, errSTUNIgnored
+	}
+	msgType := binary.BigEndian.Uint16(msg[0:])
+	length := int(binary.BigEndian.Uint16(msg[2:]))
+	if stunHeaderSize+length > len(msg) {
+		return nil, fmt.Errorf("truncated STUN message")
+	}
+	attrs := msg[stunHeaderSize : stunHeaderSize+length]
+
+	var mapped, fallback *net.UDPAddr
+	var errorCode string
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+attrLen > len(attrs) {
+			return nil, fmt.Errorf("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case stunAttrXORMappedAddress, stunAttrXORMappedOld:
+			if addr, err := parseSTUNAddress(value, true, txID); err == nil {
+				mapped = addr
+			}
+		case stunAttrMappedAddress:
+			if addr, err := parseSTUNAddress(value, false, txID); err == nil {
+				fallback = addr
+			}
+		case stunAttrErrorCode:
+			if len(value) >= 4 {
+				errorCode = fmt.Sprintf("%d %s", int(value[2]&0x7)*100+int(value[3]), strings.TrimSpace(string(value[4:])))
+			}
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		next := 4 + (attrLen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	switch msgType {
+	case stunBindingSuccess:
+	case stunBindingError:
+		return nil, fmt.Errorf("server returned error %s", errorCode)
+	default:
+		return nil, errSTUNIgnored
+	}
+	if mapped == nil {
+		mapped = fallback
+	}
+	if mapped == nil {
+		return nil, fmt.Errorf("response has no mapped address")
+	}
+	return mapped, nil
+}
+
+// parseSTUNAddress decodes a (XOR-)MAPPED-ADDRESS attribute value.
+func parseSTUNAddress(value []byte, xor bool, txID [12]byte) (*net.UDPAddr, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("short address attribute")
+	}
+	family := value[1]
+	port := binary.BigEndian.Uint16(value[2:])
+	var ip net.IP
+	switch family {
+	case 0x01:
+		if len(value) < 8 {
+			return nil, fmt.Errorf("short IPv4 address")
+		}
+		ip = net.IP(append([]byte(nil), value[4:8]...))
+	case 0x02:
+		if len(value) < 20 {
+			return nil, fmt.Errorf("short IPv6 address")
+		}
+		ip = net.IP(append([]byte(nil), value[4:20]...))
+	default:
+		return nil, fmt.Errorf("unknown address family %d", family)
+	}
+	if xor {
+		port ^= stunMagicCookie >> 16
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+		copy(key[4:], txID[:])
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,189 @@
+package ipfetcher
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTxID = [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+// stunMessage builds a STUN message of msgType with the given attributes.
+func stunMessage(msgType uint16, txID [12]byte, attrs ...[]byte) []byte {
+	msg := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(msg[0:], msgType)
+	binary.BigEndian.PutUint32(msg[4:], stunMagicCookie)
+	copy(msg[8:], txID[:])
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+	binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)-stunHeaderSize))
+	return msg
+}
+
+// stunAttr encodes an attribute, padded to a multiple of 4 bytes.
+func stunAttr(attrType uint16, value []byte) []byte {
+	attr := make([]byte, 4, 4+len(value)+3)
+	binary.BigEndian.PutUint16(attr[0:], attrType)
+	binary.BigEndian.PutUint16(attr[2:], uint16(len(value)))
+	attr = append(attr, value...)
+	for len(attr)%4 != 0 {
+		attr = append(attr, 0)
+	}
+	return attr
+}
+
+// stunAddress encodes a (XOR-)MAPPED-ADDRESS value for ip and port.
+func stunAddress(ip string, port int, xor bool, txID [12]byte) []byte {
+	addr := net.ParseIP(ip)
+	family := byte(0x02)
+	if v4 := addr.To4(); v4 != nil {
+		addr, family = v4, 0x01
+	}
+	value := []byte{0, family, 0, 0}
+	if xor {
+		port ^= stunMagicCookie >> 16
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+		copy(key[4:], txID[:])
+		masked := make([]byte, len(addr))
+		for i := range addr {
+			masked[i] = addr[i] ^ key[i]
+		}
+		addr = masked
+	}
+	binary.BigEndian.PutUint16(value[2:], uint16(port))
+	return append(value, addr...)
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	otherTxID := testTxID
+	otherTxID[11] = 0xff
+	software := stunAttr(0x8022, []byte("fake"))
+	xorV4 := stunAttr(stunAttrXORMappedAddress, stunAddress("203.0.113.7", 61000, true, testTxID))
+	badCookie := stunMessage(stunBindingSuccess, testTxID, xorV4)
+	binary.BigEndian.PutUint32(badCookie[4:], 0x12345678)
+	truncated := stunMessage(stunBindingSuccess, testTxID, xorV4)
+	truncated = truncated[:len(truncated)-4]
+	unpaddedLast := stunMessage(stunBindingSuccess, testTxID, xorV4, []byte{0x80, 0x22, 0, 5, 'a', 'b', 'c', 'd', 'e'})
+	longAttr := stunMessage(stunBindingSuccess, testTxID, []byte{0x00, 0x20, 0, 12, 0, 1, 0, 0})
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    string // host:port
+		wantErr string
+		ignored bool
+	}{
+		{name: "XOR-MAPPED-ADDRESS IPv4", msg: stunMessage(stunBindingSuccess, testTxID, xorV4), want: "203.0.113.7:61000"},
+		{name: "XOR-MAPPED-ADDRESS IPv6", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrXORMappedAddress, stunAddress("2001:db8::1234", 3478, true, testTxID))), want: "[2001:db8::1234]:3478"},
+		{name: "pre-RFC 5389 XOR attribute", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrXORMappedOld, stunAddress("198.51.100.1", 1, true, testTxID))), want: "198.51.100.1:1"},
+		{name: "MAPPED-ADDRESS only", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrMappedAddress, stunAddress("192.0.2.9", 5000, false, testTxID))), want: "192.0.2.9:5000"},
+		{name: "XOR-MAPPED-ADDRESS preferred", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrMappedAddress, stunAddress("192.0.2.9", 5000, false, testTxID)), xorV4), want: "203.0.113.7:61000"},
+		{name: "padded attribute first", msg: stunMessage(stunBindingSuccess, testTxID, stunAttr(0x8022, []byte("abcde")), xorV4),
+			want: "203.0.113.7:61000"},
+		{name: "unpadded last attribute", msg: unpaddedLast, want: "203.0.113.7:61000"},
+		{name: "error response", msg: stunMessage(stunBindingError, testTxID, stunAttr(stunAttrErrorCode, append([]byte{0, 0, 4, 20}, "Unknown Attribute"...))),
+			wantErr: "server returned error 420 Unknown Attribute"},
+		{name: "no mapped address", msg: stunMessage(stunBindingSuccess, testTxID, software), wantErr: "no mapped address"},
+		{name: "unknown address family", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrXORMappedAddress, []byte{0, 3, 0, 80, 1, 2, 3, 4})), wantErr: "no mapped address"},
+		{name: "short IPv6 address", msg: stunMessage(stunBindingSuccess, testTxID,
+			stunAttr(stunAttrXORMappedAddress, stunAddress("2001:db8::1", 80, true, testTxID)[:12])), wantErr: "no mapped address"},
+		{name: "truncated message", msg: truncated, wantErr: "truncated STUN message"},
+		{name: "truncated attribute", msg: longAttr, wantErr: "truncated STUN attribute"},
+		{name: "short header", msg: stunMessage(stunBindingSuccess, testTxID)[:12], ignored: true},
+		{name: "wrong magic cookie", msg: badCookie, ignored: true},
+		{name: "transaction ID mismatch", msg: stunMessage(stunBindingSuccess, otherTxID, xorV4), ignored: true},
+		{name: "not a response", msg: stunMessage(stunBindingRequest, testTxID), ignored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := parseSTUNResponse(tt.msg, testTxID)
+			checkSTUNResult(t, addr, err, tt.want, tt.wantErr, tt.ignored)
+		})
+	}
+}
+
+// TestParseSTUNResponseRFC5769 decodes the XOR-MAPPED-ADDRESS attributes of
+// the sample responses in RFC 5769, sections 2.2 and 2.3.
+func TestParseSTUNResponseRFC5769(t *testing.T) {
+	txID := [12]byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	for _, tt := range []struct {
+		attr []byte
+		want string
+	}{
+		{[]byte{0x00, 0x20, 0x00, 0x08, 0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}, "192.0.2.1:32853"},
+		{[]byte{
+			0x00, 0x20, 0x00, 0x14, 0x00, 0x02, 0xa1, 0x47,
+			0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79,
+			0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+		}, "[2001:db8:1234:5678:11:2233:4455:6677]:32853"},
+	} {
+		addr, err := parseSTUNResponse(stunMessage(stunBindingSuccess, txID, tt.attr), txID)
+		checkSTUNResult(t, addr, err, tt.want, "", false)
+	}
+}
+
+func checkSTUNResult(t *testing.T, addr *net.UDPAddr, err error, want, wantErr string, ignored bool) {
+	t.Helper()
+	switch {
+	case ignored:
+		if err != errSTUNIgnored {
+			t.Errorf("parseSTUNResponse() = %v, %v; want errSTUNIgnored", addr, err)
+		}
+	case wantErr != "":
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("parseSTUNResponse() error = %v, want %q", err, wantErr)
+		}
+	case err != nil:
+		t.Errorf("parseSTUNResponse() error = %v", err)
+	case addr.String() != want:
+		t.Errorf("parseSTUNResponse() = %s, want %s", addr, want)
+	}
+}
+
+func TestSTUNFetch(t *testing.T) {
+	old := stunTimeout
+	stunTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { stunTimeout = old })
+
+	// reply answers a binding request with mapped, under the given transaction ID.
+	reply := func(mapped string, txID func(req []byte) [12]byte) func([]byte) []byte {
+		return func(req []byte) []byte {
+			id := txID(req)
+			return stunMessage(stunBindingSuccess, id, stunAttr(stunAttrXORMappedAddress, stunAddress(mapped, 40000, true, id)))
+		}
+	}
+	echo := func(req []byte) (id [12]byte) {
+		copy(id[:], req[8:20])
+		return id
+	}
+
+	srv := newFakeUDPServer(t, reply("203.0.113.7", echo))
+	details, err := STUNSource{Servers: []string{srv.addr()}}.Fetch(testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.IP != "203.0.113.7" || !strings.Contains(details.NATMapping, "-> 203.0.113.7:40000") {
+		t.Errorf("Fetch() = %+v", details)
+	}
+	if req := srv.received()[0]; len(req) != stunHeaderSize || binary.BigEndian.Uint16(req) != stunBindingRequest {
+		t.Errorf("request = %x, want a bare binding request", req)
+	}
+
+	v6 := newFakeUDPServer(t, reply("2001:db8::7", echo))
+	checkFetch(t, STUNSource{Servers: []string{v6.addr()}, Binding: Binding{Family: IPv4}}, "", "is not an IPv4 address")
+
+	stray := newFakeUDPServer(t, reply("203.0.113.7", func([]byte) [12]byte { return testTxID }))
+	checkFetch(t, STUNSource{Servers: []string{stray.addr()}}, "", "no response within")
+
+	// The first server only sends stray packets; the second one answers.
+	checkFetch(t, STUNSource{Servers: []string{stray.addr(), srv.addr()}}, "203.0.113.7", "")
+}
@@ -0,0 +1,198 @@
+package ipfetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ubusAnonymousSession is the session ID used to log in.
+const ubusAnonymousSession = "00000000000000000000000000000000"
+
+// ubusStatus names the status codes of ubus calls (libubus UBUS_STATUS_*).
+var ubusStatus = map[int]string{
+	1:  "invalid command",
+	2:  "invalid argument",
+	3:  "method not found",
+	4:  "not found",
+	5:  "no data",
+	6:  "permission denied",
+	7:  "timeout",
+	8:  "not supported",
+	9:  "unknown error",
+	10: "connection failed",
+}
+
+// UbusSource logs into OpenWrt's ubus JSON-RPC endpoint (rpcd behind
+// uhttpd, usually http://router/ubus) and reads the address of a network
+// interface from `ubus call network.interface.<name> status`.
+type UbusSource struct {
+	Name     string // Set for [[ip_source]] tables, shown in logs
+	URL      string
+	Username string // root by default
+	Password string // Never logged
+	// WANInterface is the OpenWrt interface to read; empty means "wan"
+	// for IPv4 and "wan6" for IPv6.
+	WANInterface string
+	// JSONPath selects the address in the status answer instead of the
+	// first ipv4-address or ipv6-address.
+	JSONPath string
+	Binding  Binding
+}
+
+func (s UbusSource) String() string {
+	desc := "ubus " + s.URL + " " + s.wanInterface() + s.Binding.String()
+	if s.Name != "" {
+		return s.Name + " (" + desc + ")"
+	}
+	return desc
+}
+
+func (s UbusSource) wanInterface() string {
+	switch {
+	case s.WANInterface != "":
+		return s.WANInterface
+	case s.Binding.Family == IPv6:
+		return "wan6"
+	default:
+		return "wan"
+	}
+}
+
+// Fetch implements Source. Only the IP field is filled.
+func (s UbusSource) Fetch(logger *logrus.Logger) (IPDetails, error) {
+	ip, err := s.fetch(logger)
+	if err != nil {
+		return IPDetails{}, fmt.Errorf("failed to get IP from %s: %w", s, err)
+	}
+	if err := checkWANAddress(s, s.Binding.Family, ip); err != nil {
+		return IPDetails{}, err
+	}
+	logger.Debugf("Fetched IP %s from %s", ip, s)
+	return IPDetails{IP: ip.String()}, nil
+}
+
+func (s UbusSource) fetch(logger *logrus.Logger) (net.IP, error) {
+	client, err := s.Binding.lanClient()
+	if err != nil {
+		return nil, err
+	}
+	username := s.Username
+	if username == "" {
+		username = "root"
+	}
+	var login struct {
+		Session string `json:"ubus_rpc_session"`
+	}
+	err = s.call(client, ubusAnonymousSession, "session", "login", map[string]string{"username": username, "password": s.Password}, &login)
+	if err != nil {
+		return nil, fmt.Errorf("login as %s failed: %w", username, err)
+	}
+	if login.Session == "" {
+		return nil, fmt.Errorf("login as %s returned no session", username)
+	}
+	defer func() {
+		// Sessions expire on their own, but there is no need to wait for that.
+		if err := s.call(client, login.Session, "session", "destroy", struct{}{}, nil); err != nil {
+			logger.Debugf("Failed to log out of %s: %v", s.URL, err)
+		}
+	}()
+
+	object := "network.interface." + s.wanInterface()
+	var status json.RawMessage
+	if err := s.call(client, login.Session, object, "status", struct{}{}, &status); err != nil {
+		return nil, fmt.Errorf("%s status: %w", object, err)
+	}
+	if s.JSONPath != "" {
+		return extractIP(status, s.JSONPath, "")
+	}
+
+	var iface struct {
+		Up   bool `json:"up"`
+		IPv4 []struct {
+			Address string `json:"address"`
+		} `json:"ipv4-address"`
+		IPv6 []struct {
+			Address string `json:"address"`
+		} `json:"ipv6-address"`
+	}
+	if err := json.Unmarshal(status, &iface); err != nil {
+		return nil, fmt.Errorf("invalid %s status: %w", object, err)
+	}
+	if !iface.Up {
+		return nil, fmt.Errorf("interface %s is down", s.wanInterface())
+	}
+	var addrs []string
+	for _, a := range iface.IPv4 {
+		addrs = append(addrs, a.Address)
+	}
+	if s.Binding.Family != IPv4 {
+		for _, a := range iface.IPv6 {
+			addrs = append(addrs, a.Address)
+		}
+	}
+	for _, raw := range addrs {
+		// Skip addresses of the other family, e.g. on a dual-stack wan.
+		if ip, err := parseAddress(raw); err == nil && s.Binding.Family.matches(ip) {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no %s address", s.wanInterface(), s.Binding.Family)
+}
+
+// call invokes a ubus method over JSON-RPC and decodes its result data into out.
+func (s UbusSource) call(client *http.Client, session, object, method string, args, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "call",
+		"params":  []interface{}{session, object, method, args},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d (is rpcd's ubus endpoint at %s?)", resp.StatusCode, s.URL)
+	}
+	var rpc struct {
+		Result []json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&rpc); err != nil {
+		return fmt.Errorf("invalid JSON-RPC answer: %w", err)
+	}
+	if rpc.Error != nil {
+		// -32002 "Access denied" means the session has expired or lacks the ACL.
+		return fmt.Errorf("JSON-RPC error %d (%s)", rpc.Error.Code, rpc.Error.Message)
+	}
+	if len(rpc.Result) == 0 {
+		return fmt.Errorf("empty JSON-RPC result")
+	}
+	var code int
+	if err := json.Unmarshal(rpc.Result[0], &code); err != nil {
+		return fmt.Errorf("invalid JSON-RPC result: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("ubus status %d (%s)", code, ubusStatus[code])
+	}
+	if out == nil {
+		return nil
+	}
+	if len(rpc.Result) < 2 {
+		return fmt.Errorf("JSON-RPC result has no data")
+	}
+	return json.Unmarshal(rpc.Result[1], out)
+}
@@ -0,0 +1,150 @@
+package ipfetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const ubusTestSession = "0123456789abcdef0123456789abcdef"
+
+// fakeUbus serves rpcd's JSON-RPC endpoint. answers maps "object.method" to
+// the JSON-RPC response body; login and destroy succeed unless overridden.
+// It returns the server URL and a function listing the calls made, as
+// "session object.method".
+func fakeUbus(t *testing.T, answers map[string]string) (string, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil || req.Method != "call" || len(req.Params) != 4 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var session, object, method string
+		json.Unmarshal(req.Params[0], &session)
+		json.Unmarshal(req.Params[1], &object)
+		json.Unmarshal(req.Params[2], &method)
+		mu.Lock()
+		calls = append(calls, session+" "+object+"."+method)
+		mu.Unlock()
+
+		if answer, ok := answers[object+"."+method]; ok {
+			fmt.Fprint(w, answer)
+			return
+		}
+		switch object + "." + method {
+		case "session.login":
+			var args struct{ Username, Password string }
+			json.Unmarshal(req.Params[3], &args)
+			if session != ubusAnonymousSession || args.Username != "root" || args.Password != "pw" {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[6]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":[0,{"ubus_rpc_session":%q,"timeout":300}]}`, ubusTestSession)
+		case "session.destroy":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[0]}`)
+		default:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[4]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/ubus", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), calls...)
+	}
+}
+
+// ubusStatusAnswer wraps an interface status in a successful JSON-RPC answer.
+func ubusStatusAnswer(status string) string {
+	return `{"jsonrpc":"2.0","id":1,"result":[0,` + status + `]}`
+}
+
+const dualStackWAN = `{"up":true,"l3_device":"pppoe-wan",
+	"ipv4-address":[{"address":"203.0.113.7","mask":32}],
+	"ipv6-address":[{"address":"2001:db8::7","mask":64}]}`
+
+func TestUbusSourceCallSequence(t *testing.T) {
+	url, calls := fakeUbus(t, map[string]string{"network.interface.wan.status": ubusStatusAnswer(dualStackWAN)})
+	checkFetch(t, UbusSource{URL: url, Password: "pw"}, "203.0.113.7", "")
+
+	want := []string{
+		ubusAnonymousSession + " session.login",
+		ubusTestSession + " network.interface.wan.status",
+		ubusTestSession + " session.destroy",
+	}
+	if got := calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUbusSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers map[string]string
+		src     UbusSource
+		want    string
+		wantErr string
+		logout  bool // Whether session.destroy must be called
+	}{
+		{name: "IPv4 on a dual-stack wan", answers: map[string]string{"network.interface.wan.status": ubusStatusAnswer(dualStackWAN)},
+			src: UbusSource{Binding: Binding{Family: IPv4}}, want: "203.0.113.7", logout: true},
+		{name: "IPv6 reads wan6", answers: map[string]string{"network.interface.wan6.status": ubusStatusAnswer(
+			`{"up":true,"ipv6-address":[{"address":"2001:db8::6","mask":64}]}`)},
+			src: UbusSource{Binding: Binding{Family: IPv6}}, want: "2001:db8::6", logout: true},
+		{name: "private address", answers: map[string]string{"network.interface.wan.status": ubusStatusAnswer(
+			`{"up":true,"ipv4-address":[{"address":"100.64.3.2","mask":10}]}`)},
+			src: UbusSource{}, wantErr: "not a public address (is the router behind another NAT?)", logout: true},
+		{name: "IPv6 on a custom interface", answers: map[string]string{"network.interface.wanb.status": ubusStatusAnswer(dualStackWAN)},
+			src: UbusSource{WANInterface: "wanb", Binding: Binding{Family: IPv6}}, want: "2001:db8::7", logout: true},
+		{name: "JSON path", answers: map[string]string{"network.interface.wan.status": ubusStatusAnswer(
+			`{"up":true,"route":[{"target":"0.0.0.0","source":"198.51.100.4/32"}]}`)},
+			src: UbusSource{JSONPath: "route[0].source"}, want: "198.51.100.4", logout: true},
+		{name: "interface down", answers: map[string]string{"network.interface.wan.status": ubusStatusAnswer(`{"up":false}`)},
+			src: UbusSource{}, wantErr: "interface wan is down", logout: true},
+		{name: "no address", answers: map[string]string{"network.interface.wan.status": ubusStatusAnswer(`{"up":true,"ipv4-address":[]}`)},
+			src: UbusSource{Binding: Binding{Family: IPv4}}, wantErr: "interface wan has no IPv4 address", logout: true},
+		{name: "unknown interface", src: UbusSource{WANInterface: "wan9"},
+			wantErr: "network.interface.wan9 status: ubus status 4 (not found)", logout: true},
+		{name: "access denied", answers: map[string]string{"network.interface.wan.status": `{"jsonrpc":"2.0","id":1,"error":{"code":-32002,"message":"Access denied"}}`},
+			src: UbusSource{}, wantErr: "JSON-RPC error -32002 (Access denied)", logout: true},
+		{name: "status without data", answers: map[string]string{"network.interface.wan.status": `{"jsonrpc":"2.0","id":1,"result":[0]}`},
+			src: UbusSource{}, wantErr: "JSON-RPC result has no data", logout: true},
+		{name: "wrong password", src: UbusSource{Password: "wrong"}, wantErr: "login as root failed: ubus status 6 (permission denied)"},
+		{name: "login without session", answers: map[string]string{"session.login": `{"jsonrpc":"2.0","id":1,"result":[0,{}]}`},
+			src: UbusSource{}, wantErr: "login as root returned no session"},
+		{name: "empty result", answers: map[string]string{"session.login": `{"jsonrpc":"2.0","id":1,"result":[]}`},
+			src: UbusSource{}, wantErr: "empty JSON-RPC result"},
+		{name: "not JSON-RPC", answers: map[string]string{"session.login": `<html>LuCI</html>`},
+			src: UbusSource{}, wantErr: "invalid JSON-RPC answer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, calls := fakeUbus(t, tt.answers)
+			tt.src.URL = url
+			if tt.src.Password == "" {
+				tt.src.Password = "pw"
+			}
+			checkFetch(t, tt.src, tt.want, tt.wantErr)
+			got := calls()
+			if logout := got[len(got)-1] == ubusTestSession+" session.destroy"; logout != tt.logout {
+				t.Errorf("calls = %q; logged out = %v, want %v", got, logout, tt.logout)
+			}
+		})
+	}
+}
+
+func TestUbusSourceHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	checkFetch(t, UbusSource{URL: srv.URL + "/cgi-bin/luci"}, "", "status code 404 (is rpcd's ubus endpoint")
+}
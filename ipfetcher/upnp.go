@@ -0,0 +1,259 @@
+package ipfetcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSSDPAddress is the SSDP multicast group UPnP discovery is sent to.
+const DefaultSSDPAddress = "239.255.255.250:1900"
+
+// upnpSearchTargets are searched for in order; the WAN connection services
+// are what routers actually answer to most reliably.
+var upnpSearchTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// defaultUPnPService is assumed when ControlURL is configured directly.
+const defaultUPnPService = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// fetchUPnP finds the router's WAN connection service and calls GetExternalIPAddress.
+func (s RouterSource) fetchUPnP(logger *logrus.Logger) (net.IP, error) {
+	client, err := s.Binding.lanClient()
+	if err != nil {
+		return nil, err
+	}
+	controlURL, service := s.ControlURL, defaultUPnPService
+	if controlURL == "" {
+		location, err := s.discoverIGD()
+		if err != nil {
+			return nil, err
+		}
+		logger.Debugf("UPnP gateway description at %s", location)
+		if controlURL, service, err = upnpControlURL(client, location); err != nil {
+			return nil, err
+		}
+	}
+	return upnpExternalIP(client, controlURL, service)
+}
+
+// discoverIGD sends SSDP M-SEARCH requests and returns the LOCATION of the
+// first Internet Gateway Device that answers.
+func (s RouterSource) discoverIGD() (string, error) {
+	target := s.SSDPAddress
+	if target == "" {
+		target = DefaultSSDPAddress
+	}
+	raddr, err := net.ResolveUDPAddr("udp4", target)
+	if err != nil {
+		return "", err
+	}
+	conn, err := s.Binding.listenUDP()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	for _, st := range upnpSearchTargets {
+		msg := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + DefaultSSDPAddress + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n" +
+			"ST: " + st + "\r\n\r\n"
+		if _, err := conn.WriteTo([]byte(msg), raddr); err != nil {
+			return "", fmt.Errorf("SSDP search failed: %w", err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(routerTimeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", fmt.Errorf("no UPnP gateway answered within %s (is UPnP enabled on the router?)", routerTimeout)
+		}
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue // Not an SSDP answer
+		}
+		st := resp.Header.Get("ST")
+		if location := resp.Header.Get("Location"); location != "" && isIGDTarget(st) {
+			return location, nil
+		}
+	}
+}
+
+func isIGDTarget(st string) bool {
+	for _, target := range upnpSearchTargets {
+		if strings.EqualFold(st, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// upnpDevice is the part of a UPnP device description used here.
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// upnpControlURL reads the device description at location and returns the
+// control URL and type of its WANIPConnection or WANPPPConnection service.
+func upnpControlURL(client *http.Client, location string) (string, string, error) {
+	resp, err := client.Get(location)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read gateway description: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("gateway description at %s: status code %d", location, resp.StatusCode)
+	}
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return "", "", fmt.Errorf("invalid gateway description at %s: %w", location, err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if desc.URLBase != "" {
+		if b, err := url.Parse(desc.URLBase); err == nil {
+			base = b
+		}
+	}
+	var find func(d upnpDevice) (string, string, bool)
+	find = func(d upnpDevice) (string, string, bool) {
+		for _, svc := range d.Services {
+			if strings.Contains(svc.ServiceType, ":WANIPConnection:") || strings.Contains(svc.ServiceType, ":WANPPPConnection:") {
+				return svc.ControlURL, svc.ServiceType, true
+			}
+		}
+		for _, child := range d.Devices {
+			if control, service, ok := find(child); ok {
+				return control, service, true
+			}
+		}
+		return "", "", false
+	}
+	control, service, ok := find(desc.Device)
+	if !ok {
+		return "", "", fmt.Errorf("gateway at %s has no WANIPConnection or WANPPPConnection service", location)
+	}
+	ref, err := url.Parse(control)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid control URL %q: %w", control, err)
+	}
+	return base.ResolveReference(ref).String(), service, nil
+}
+
+// upnpExternalIP calls GetExternalIPAddress on the WAN connection service.
+func upnpExternalIP(client *http.Client, controlURL, service string) (net.IP, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + service + `"></u:GetExternalIPAddress></s:Body></s:Envelope>`
+	ctx, cancel := context.WithTimeout(context.Background(), routerTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+service+`#GetExternalIPAddress"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GetExternalIPAddress failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a few elements matter, so scan for them instead of modelling SOAP.
+	values := soapValues(data, "NewExternalIPAddress", "errorCode", "errorDescription")
+	if resp.StatusCode != http.StatusOK {
+		if values["errorCode"] != "" {
+			return nil, fmt.Errorf("GetExternalIPAddress returned UPnP error %s (%s)", values["errorCode"], values["errorDescription"])
+		}
+		return nil, fmt.Errorf("GetExternalIPAddress: status code %d", resp.StatusCode)
+	}
+	raw := strings.TrimSpace(values["NewExternalIPAddress"])
+	ip := net.ParseIP(raw)
+	if ip == nil || ip.IsUnspecified() {
+		return nil, fmt.Errorf("router has no WAN address (got %q; is the WAN connection up?)", raw)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip, nil
+}
+
+// soapValues returns the text of the first element with each of the given
+// local names.
+func soapValues(data []byte, names ...string) map[string]string {
+	values := make(map[string]string, len(names))
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var current string
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return values
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+		case xml.EndElement:
+			current = ""
+		case xml.CharData:
+			for _, name := range names {
+				if current == name && values[name] == "" {
+					values[name] = string(t)
+				}
+			}
+		}
+	}
+}
+
+// listenUDP opens an unconnected IPv4 UDP socket bound like b, for SSDP.
+func (b Binding) listenUDP() (net.PacketConn, error) {
+	local, err := b.localIP()
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	if b.Interface != "" && canBindToDevice {
+		lc.Control = bindToDevice(b.Interface)
+	}
+	addr := ":0"
+	if local != nil {
+		addr = net.JoinHostPort(local.String(), "0")
+	}
+	return lc.ListenPacket(context.Background(), "udp4", addr)
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journalSocket is where systemd-journald accepts native protocol datagrams.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldHook writes entries to journald with a PRIORITY and one journal
+// field per logrus field, so they can be filtered with journalctl FIELD=value.
+type journaldHook struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+func newJournaldHook(identifier string) (*journaldHook, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("journald is not available: %w", err)
+	}
+	return &journaldHook{conn: conn, identifier: identifier}, nil
+}
+
+// Levels implements logrus.Hook.
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", entry.Message)
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(syslogSeverity(entry.Level)))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", h.identifier)
+	if entry.HasCaller() {
+		writeJournalField(&b, "CODE_FILE", filepath.Base(entry.Caller.File))
+		writeJournalField(&b, "CODE_LINE", strconv.Itoa(entry.Caller.Line))
+		writeJournalField(&b, "CODE_FUNC", entry.Caller.Function)
+	}
+	for k, v := range entry.Data {
+		if k == logrus.ErrorKey {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+		}
+		if name := journalFieldName(k); name != "" {
+			writeJournalField(&b, name, fmt.Sprint(v))
+		}
+	}
+	_, err := h.conn.Write(b.Bytes())
+	return err
+}
+
+func (h *journaldHook) close() {
+	h.conn.Close()
+}
+
+// writeJournalField appends one field in the native journal protocol. Values
+// containing newlines use the length-prefixed binary form.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName converts a logrus field name to a journal field name:
+// uppercase letters, digits and underscores, not starting with an underscore
+// (those are reserved for trusted fields).
+func journalFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
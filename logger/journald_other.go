@@ -0,0 +1,24 @@
+//go:build !linux
+
+package logger
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journaldHook is only implemented on Linux.
+type journaldHook struct{}
+
+func newJournaldHook(identifier string) (*journaldHook, error) {
+	return nil, errors.New("journald output is only available on Linux")
+}
+
+// Levels implements logrus.Hook.
+func (h *journaldHook) Levels() []logrus.Level { return nil }
+
+// Fire implements logrus.Hook.
+func (h *journaldHook) Fire(entry *logrus.Entry) error { return nil }
+
+func (h *journaldHook) close() {}
@@ -1,10 +1,13 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -12,11 +15,239 @@ import (
 
 var log *logrus.Logger
 
+// Options controls the level, format and destination of log output.
+type Options struct {
+	Level        logrus.Level
+	JSON         bool // JSON lines instead of logrus' text format
+	ReportCaller bool
+	Stdout       bool // Also write to the console; set for interactive runs
+	Stderr       bool // Write the console output to stderr, leaving stdout to command output
+
+	DisableFile bool
+	File        string // Full path of the log file; overrides Dir
+	Dir         string // Directory for <serviceName>.log; empty means DefaultDir
+	MaxSizeMB   int
+	MaxBackups  int
+	MaxAgeDays  int
+	Compress    bool
+
+	Journald bool          // Send entries to the systemd journal (Linux only)
+	Syslog   SyslogOptions // Forward entries to a syslog server when Syslog.URL is set
+}
+
+// outputHook is a log output implemented as a logrus hook rather than an io.Writer.
+type outputHook interface {
+	logrus.Hook
+	close()
+}
+
+var (
+	serviceLogName string
+	fileWriter     *lumberjack.Logger
+	outputHooks    []outputHook
+)
+
+// DefaultOptions returns the settings used when the [log] table is empty.
+func DefaultOptions(isInteractive bool) Options {
+	return Options{
+		Level:        logrus.InfoLevel,
+		ReportCaller: true,
+		Stdout:       isInteractive,
+		MaxSizeMB:    10,
+		MaxBackups:   3,
+		MaxAgeDays:   7,
+	}
+}
+
 // Init initializes the global logger.
 // serviceName is used for the log file name, e.g., "ddns-server.log".
+// Until Configure is called, entries only go to the console (stderr when not
+// interactive): the log file is opened once the final options are known, so
+// that `[log] disable_file` and -no-log-file never create a log directory.
 func Init(isInteractive bool, serviceName string) {
 	log = logrus.New()
+	log.AddHook(redactor) // First, so later hooks and the formatter only see masked values
+	serviceLogName = serviceName
+	opts := DefaultOptions(isInteractive)
+	opts.DisableFile = true
+	Configure(opts) // Cannot fail without a file, journald or syslog
+}
+
+// Configure applies opts to the global logger. The logger instance is kept,
+// so loggers already handed out by L() pick up the new settings.
+// If the log file, journald or syslog cannot be used, logging continues on
+// the remaining outputs and the error is returned.
+func Configure(opts Options) error {
+	if log == nil {
+		log = logrus.New()
+		log.AddHook(redactor)
+	}
+
+	if opts.JSON {
+		log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: "2006-01-02 15:04:05"})
+	} else {
+		log.SetFormatter(&logrus.TextFormatter{TimestampFormat: "2006-01-02 15:04:05"})
+	}
+	log.SetReportCaller(opts.ReportCaller)
+	log.SetLevel(opts.Level)
+
+	var writers []io.Writer
+	if opts.Stdout {
+		if opts.Stderr {
+			writers = append(writers, os.Stderr)
+		} else {
+			writers = append(writers, os.Stdout)
+		}
+	}
+
+	var fileErr error
+	if fileWriter != nil {
+		fileWriter.Close()
+		fileWriter = nil
+	}
+	if !opts.DisableFile {
+		path, err := logFilePath(opts)
+		if err != nil {
+			fileErr = err
+		} else {
+			fileWriter = &lumberjack.Logger{
+				Filename:   path,
+				MaxSize:    opts.MaxSizeMB, // MB
+				MaxBackups: opts.MaxBackups,
+				MaxAge:     opts.MaxAgeDays, // days
+				Compress:   opts.Compress,
+			}
+			writers = append(writers, fileWriter)
+		}
+	}
+
+	hookErr := configureHooks(opts)
+
+	switch {
+	case len(writers) == 0 && len(outputHooks) > 0:
+		// Everything goes to journald/syslog. Writing to stderr as well would
+		// duplicate each entry in the journal when running under systemd.
+		log.SetOutput(io.Discard)
+	case len(writers) == 0:
+		// Never drop logs entirely: a service without a file still has stderr.
+		log.SetOutput(os.Stderr)
+	case len(writers) == 1:
+		log.SetOutput(writers[0])
+	default:
+		log.SetOutput(io.MultiWriter(writers...))
+	}
+	return errors.Join(fileErr, hookErr)
+}
+
+// configureHooks replaces the journald and syslog hooks according to opts and
+// keeps the system logger hook, if any, unless journald is used.
+// The redactor stays the first hook so outputs only ever see masked entries.
+func configureHooks(opts Options) error {
+	for _, h := range outputHooks {
+		h.close()
+	}
+	outputHooks = nil
+
+	var errs []error
+	if opts.Journald {
+		if h, err := newJournaldHook(serviceLogName); err != nil {
+			errs = append(errs, err)
+		} else {
+			outputHooks = append(outputHooks, h)
+		}
+	}
+	if opts.Syslog.URL != "" {
+		if h, err := newSyslogHook(opts.Syslog, serviceLogName); err != nil {
+			errs = append(errs, err)
+		} else {
+			outputHooks = append(outputHooks, h)
+		}
+	}
+
+	installHooks()
+	return errors.Join(errs...)
+}
+
+// installHooks replaces the logger's hooks with the redactor, the output
+// hooks and the system logger hook.
+func installHooks() {
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(redactor)
+	journald := false
+	for _, h := range outputHooks {
+		hooks.Add(h)
+		if _, ok := h.(*journaldHook); ok {
+			journald = true
+		}
+	}
+	// Under systemd the system logger writes to syslog, which the journal
+	// also collects, so together with journald each warning would be
+	// recorded twice.
+	if systemHook != nil && !journald {
+		hooks.Add(systemHook)
+	}
+	log.ReplaceHooks(hooks)
+}
+
+// FilePath returns the log file currently written to, or "" if file output is disabled.
+func FilePath() string {
+	if fileWriter == nil {
+		return ""
+	}
+	return fileWriter.Filename
+}
 
+// logFilePath resolves the log file for opts and makes sure its directory is writable.
+func logFilePath(opts Options) (string, error) {
+	if opts.File != "" {
+		if err := ensureWritableDir(filepath.Dir(opts.File)); err != nil {
+			return "", err
+		}
+		return opts.File, nil
+	}
+	if opts.Dir != "" {
+		if err := ensureWritableDir(opts.Dir); err != nil {
+			return "", err
+		}
+		return filepath.Join(opts.Dir, serviceLogName+".log"), nil
+	}
+
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, serviceLogName+".log"), nil
+}
+
+// DefaultDir returns the first writable directory among: the executable's
+// directory (the historical location), the platform's log directory, and the
+// user's cache directory. A service account running a binary installed in a
+// read-only location therefore still gets a log file.
+func DefaultDir() (string, error) {
+	candidates := []string{executableDir()}
+	switch runtime.GOOS {
+	case "windows":
+		if programData := os.Getenv("ProgramData"); programData != "" {
+			candidates = append(candidates, filepath.Join(programData, "ddns-dnspod", "logs"))
+		}
+	case "darwin":
+		candidates = append(candidates, "/Library/Logs/ddns-dnspod")
+	default:
+		candidates = append(candidates, "/var/log/ddns-dnspod")
+	}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		candidates = append(candidates, filepath.Join(cacheDir, "ddns-dnspod", "logs"))
+	}
+
+	for _, dir := range candidates {
+		if dir != "" && ensureWritableDir(dir) == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no writable log directory among %v", candidates)
+}
+
+func executableDir() string {
 	file, err := exec.LookPath(os.Args[0])
 	if err != nil {
 		// Fallback or handle error appropriately if LookPath fails
@@ -33,32 +264,20 @@ func Init(isInteractive bool, serviceName string) {
 		currentDir, _ := os.Getwd()
 		path = filepath.Join(currentDir, os.Args[0])
 	}
+	return filepath.Dir(path)
+}
 
-	logFileName := serviceName + ".log"
-	logFilePath := filepath.Join(filepath.Dir(path), logFileName)
-
-	logRotate := &lumberjack.Logger{
-		Filename:   logFilePath,
-		MaxSize:    10, // MB
-		MaxBackups: 3,
-		MaxAge:     7, // days
-		Compress:   false,
+// ensureWritableDir creates dir if needed and checks that files can be created in it.
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
 	}
-
-	log.SetFormatter(&logrus.TextFormatter{TimestampFormat: "2006-01-02 15:04:05"})
-	log.SetReportCaller(true)
-	log.SetLevel(logrus.InfoLevel)
-
-	if isInteractive {
-		writers := []io.Writer{
-			logRotate,
-			os.Stdout,
-		}
-		fileAndStdoutWriter := io.MultiWriter(writers...)
-		log.SetOutput(fileAndStdoutWriter)
-	} else {
-		log.SetOutput(logRotate)
+	probe, err := os.CreateTemp(dir, ".ddns-dnspod-write-test-*")
+	if err != nil {
+		return fmt.Errorf("log directory %s is not writable: %w", dir, err)
 	}
+	probe.Close()
+	return os.Remove(probe.Name())
 }
 
 // L returns the initialized logger instance.
@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitOpensNoLogFile(t *testing.T) {
+	dir := t.TempDir()
+	oldArgs := os.Args
+	os.Args = []string{filepath.Join(dir, "ddns-dnspod")}
+	t.Cleanup(func() {
+		os.Args = oldArgs
+		Configure(Options{DisableFile: true})
+	})
+
+	Init(false, "test")
+	if path := FilePath(); path != "" {
+		t.Errorf("FilePath() = %q after Init, want no log file", path)
+	}
+	L().SetOutput(io.Discard) // Only stderr; a file would be created regardless
+	L().Info("before Configure")
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Init wrote to the executable's directory: %v", entries)
+	}
+
+	opts := DefaultOptions(false)
+	opts.Dir = dir
+	if err := Configure(opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "test.log"); FilePath() != want {
+		t.Errorf("FilePath() = %q, want %q", FilePath(), want)
+	}
+}
@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces every secret in log output.
+const redactedValue = "******"
+
+// minSecretLength keeps short values such as "1" from being masked everywhere.
+const minSecretLength = 4
+
+// defaultSensitiveFields are masked both as logrus fields and as key=value or
+// "key":"value" pairs inside messages. Matching is case-insensitive.
+var defaultSensitiveFields = []string{
+	"secretid", "secret_id", "dnspod_secret_id",
+	"secretkey", "secret_key", "dnspod_secret_key",
+	"token", "sessiontoken", "x-tc-token",
+	"password", "passwd",
+	"authorization", "signature", "credential",
+}
+
+// Redactor is a logrus hook that masks secrets in messages and fields.
+// It must run before any other hook so that no output sees the raw values.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+	fields  map[string]bool
+	pattern *regexp.Regexp
+}
+
+// NewRedactor returns a Redactor that masks the default sensitive fields.
+func NewRedactor() *Redactor {
+	r := &Redactor{fields: map[string]bool{}}
+	r.AddFields(defaultSensitiveFields...)
+	return r
+}
+
+// AddSecrets registers literal values, such as the configured SecretKey, to be masked wherever they appear.
+func (r *Redactor) AddSecrets(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		if len(v) < minSecretLength || contains(r.secrets, v) {
+			continue
+		}
+		r.secrets = append(r.secrets, v)
+	}
+	// Replace longer secrets first so one secret containing another is fully masked.
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// AddFields registers additional field names whose values are masked.
+func (r *Redactor) AddFields(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			r.fields[name] = true
+		}
+	}
+	quoted := make([]string, 0, len(r.fields))
+	for name := range r.fields {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	// Longest alternatives are tried first; ties are broken alphabetically
+	// so the pattern does not depend on map order.
+	sort.Slice(quoted, func(i, j int) bool {
+		if len(quoted[i]) != len(quoted[j]) {
+			return len(quoted[i]) > len(quoted[j])
+		}
+		return quoted[i] < quoted[j]
+	})
+	// Matches Key=value, Key: value, "Key":"value" and "Key": value.
+	r.pattern = regexp.MustCompile(`(?i)("?\b(?:` + strings.Join(quoted, "|") + `)"?\s*[:=]\s*"?)([^"\s,&;}]+)`)
+}
+
+// Redact returns s with all registered secrets and sensitive key/value pairs masked.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return r.pattern.ReplaceAllString(s, "${1}"+redactedValue)
+}
+
+// Levels implements logrus.Hook.
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. logrus hands hooks a copy of the entry, so
+// modifying it in place is safe.
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.Redact(entry.Message)
+	for key, value := range entry.Data {
+		r.mu.RLock()
+		sensitive := r.fields[strings.ToLower(key)]
+		r.mu.RUnlock()
+		switch {
+		case sensitive:
+			entry.Data[key] = redactedValue
+		case key == logrus.ErrorKey:
+			if err, ok := value.(error); ok {
+				entry.Data[key] = r.Redact(err.Error())
+			}
+		default:
+			if s, ok := value.(string); ok {
+				entry.Data[key] = r.Redact(s)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor is installed on the global logger by Init.
+var redactor = NewRedactor()
+
+// AddSecrets masks the given values in all output of the global logger.
+func AddSecrets(values ...string) {
+	redactor.AddSecrets(values...)
+}
+
+// AddSensitiveFields masks the values of the given field names in all output of the global logger.
+func AddSensitiveFields(names ...string) {
+	redactor.AddFields(names...)
+}
@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactFieldPatterns(t *testing.T) {
+	r := NewRedactor()
+	r.AddFields("key", "api_key", "X-Api-Key")
+	for _, tt := range []struct{ in, want string }{
+		{"SecretKey=abc123 next", "SecretKey=****** next"},
+		{`{"Token":"t0k3n","ok":true}`, `{"Token":"******","ok":true}`},
+		{"x-tc-token: abc", "x-tc-token: ******"},
+		{"api_key=abc key=def", "api_key=****** key=******"},
+		{"X-Api-Key: abc", "X-Api-Key: ******"},
+		{"keyboard=fine", "keyboard=fine"},
+	} {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Alternatives are ordered by length, longest first.
+	pattern := r.pattern.String()
+	alternatives := strings.Split(pattern[strings.Index(pattern, "(?:")+3:strings.Index(pattern, `)"?\s*`)], "|")
+	for i := 1; i < len(alternatives); i++ {
+		if len(alternatives[i]) > len(alternatives[i-1]) {
+			t.Fatalf("%q comes after the shorter %q", alternatives[i], alternatives[i-1])
+		}
+	}
+}
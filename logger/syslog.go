@@ -0,0 +1,403 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyslogOptions configures forwarding to a syslog server in RFC 5424 format.
+type SyslogOptions struct {
+	// URL of the server: udp://host:514, tcp://host:514, tls://host:6514 or unix:///dev/log.
+	// Empty disables syslog output.
+	URL      string
+	AppName  string // APP-NAME; defaults to the log file's service name
+	Facility string // e.g. daemon, user, local0; defaults to daemon
+
+	CAFile             string // PEM bundle used to verify a tls:// server
+	CertFile           string // Client certificate for mutual TLS
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// syslogWriteTimeout bounds how long a stalled server can block the sender.
+const syslogWriteTimeout = 5 * time.Second
+
+// Entries are queued and sent by a background goroutine, so a slow or
+// unreachable server never holds up the caller. While the server is down,
+// reconnection is retried with a delay doubling from syslogRetryMin to
+// syslogRetryMax, and entries are dropped in the meantime.
+const (
+	syslogQueueSize = 1000
+	syslogRetryMin  = time.Second
+	syslogRetryMax  = time.Minute
+)
+
+// structuredDataID is the SD-ID carrying logrus fields. 32473 is the private
+// enterprise number reserved for documentation in RFC 5612.
+const structuredDataID = "fields@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverity maps logrus levels to syslog severities, also used as journald PRIORITY.
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogHook sends every entry to a syslog server from a background
+// goroutine, reconnecting after failures.
+type syslogHook struct {
+	network  string // udp, tcp, unix or unixgram
+	address  string
+	tls      *tls.Config
+	facility int
+	appName  string
+	hostname string
+	framed   bool // Stream transports use octet-counting framing (RFC 6587/5425)
+
+	mu      sync.RWMutex // Guards closed against sends on a closed queue
+	closed  bool
+	queue   chan syslogItem
+	done    chan struct{} // Closed when the sender has stopped
+	dropped atomic.Int64  // Entries lost since the last successful write
+
+	// Owned by the sender goroutine.
+	conn    net.Conn
+	retryAt time.Time
+	backoff time.Duration
+}
+
+// syslogItem is a queued message, or a flush request when flushed is set.
+type syslogItem struct {
+	msg     []byte
+	flushed chan struct{}
+}
+
+func newSyslogHook(opts SyslogOptions, defaultAppName string) (*syslogHook, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog URL %q: %w", opts.URL, err)
+	}
+
+	facilityName := opts.Facility
+	if facilityName == "" {
+		facilityName = "daemon"
+	}
+	facility, ok := syslogFacilities[strings.ToLower(facilityName)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", opts.Facility)
+	}
+
+	h := &syslogHook{facility: facility, appName: opts.AppName}
+	if h.appName == "" {
+		h.appName = defaultAppName
+	}
+	if h.hostname, err = os.Hostname(); err != nil {
+		h.hostname = "-"
+	}
+
+	switch u.Scheme {
+	case "udp":
+		h.network, h.address = "udp", u.Host
+	case "tcp":
+		h.network, h.address, h.framed = "tcp", u.Host, true
+	case "tls":
+		h.network, h.address, h.framed = "tcp", u.Host, true
+		if h.tls, err = syslogTLSConfig(opts, u.Hostname()); err != nil {
+			return nil, err
+		}
+	case "unix":
+		// Local daemons such as rsyslog listen on a datagram socket at /dev/log.
+		h.network, h.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("unsupported syslog scheme %q, use udp, tcp, tls or unix", u.Scheme)
+	}
+	if h.address == "" {
+		return nil, fmt.Errorf("syslog URL %q has no address", opts.URL)
+	}
+	h.queue = make(chan syslogItem, syslogQueueSize)
+	h.done = make(chan struct{})
+	go h.run()
+	return h, nil
+}
+
+func syslogTLSConfig(opts SyslogOptions, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, InsecureSkipVerify: opts.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load syslog client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Levels implements logrus.Hook.
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. It only queues the entry; when the queue is
+// full the entry is dropped, as the other outputs still have it. Fatal and
+// panic entries wait for the queue to be sent, since the process is about
+// to end.
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	item := syslogItem{msg: h.format(entry)}
+	urgent := entry.Level <= logrus.FatalLevel
+	if urgent {
+		item.flushed = make(chan struct{})
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return nil
+	}
+	if urgent {
+		select {
+		case h.queue <- item:
+			select {
+			case <-item.flushed:
+			case <-time.After(2 * syslogWriteTimeout):
+			}
+		case <-time.After(syslogWriteTimeout):
+			h.dropped.Add(1)
+		}
+		return nil
+	}
+	select {
+	case h.queue <- item:
+	default:
+		h.dropped.Add(1)
+	}
+	return nil
+}
+
+// run sends queued messages until the queue is closed.
+func (h *syslogHook) run() {
+	defer close(h.done)
+	for item := range h.queue {
+		if item.msg != nil {
+			h.send(item.msg)
+		}
+		if item.flushed != nil {
+			close(item.flushed)
+		}
+	}
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
+
+// send writes msg, reconnecting once if the connection was dropped, and backs
+// off after a failure. It reports entries dropped in the meantime first.
+func (h *syslogHook) send(msg []byte) {
+	if h.conn == nil && time.Now().Before(h.retryAt) {
+		h.dropped.Add(1)
+		return
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if n := h.dropped.Load(); n > 0 {
+			if err = h.write(h.droppedNotice(n)); err != nil {
+				continue
+			}
+			h.dropped.Add(-n)
+		}
+		if err = h.write(msg); err == nil {
+			h.backoff = 0
+			return
+		}
+	}
+
+	if h.backoff == 0 {
+		h.backoff = syslogRetryMin
+	} else if h.backoff *= 2; h.backoff > syslogRetryMax {
+		h.backoff = syslogRetryMax
+	}
+	h.retryAt = time.Now().Add(h.backoff)
+	h.dropped.Add(1)
+	// Logging this through logrus would come back here.
+	fmt.Fprintf(os.Stderr, "syslog %s://%s: %v; retrying in %s\n", h.network, h.address, err, h.backoff)
+}
+
+// write sends msg on the current connection, dialling one if needed. A
+// failed connection is closed.
+func (h *syslogHook) write(msg []byte) error {
+	if h.conn == nil {
+		conn, err := h.dial()
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	if _, err := h.conn.Write(msg); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// droppedNotice returns a message reporting n entries dropped since the
+// last successful write.
+func (h *syslogHook) droppedNotice(n int64) []byte {
+	return h.format(&logrus.Entry{
+		Time:    time.Now(),
+		Level:   logrus.WarnLevel,
+		Message: fmt.Sprintf("%d log entries were not forwarded to syslog while it was unreachable or busy", n),
+	})
+}
+
+func (h *syslogHook) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogWriteTimeout}
+	if h.tls != nil {
+		return tls.DialWithDialer(dialer, h.network, h.address, h.tls)
+	}
+	return dialer.Dial(h.network, h.address)
+}
+
+// close stops accepting entries and waits briefly for the queued ones to be sent.
+func (h *syslogHook) close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+
+	select {
+	case <-h.done:
+	case <-time.After(syslogWriteTimeout):
+	}
+}
+
+// format renders entry as an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func (h *syslogHook) format(entry *logrus.Entry) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		h.facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format(time.RFC3339Nano),
+		headerField(h.hostname, 255), headerField(h.appName, 48), os.Getpid())
+
+	data := structuredData(entry)
+	if data == "" {
+		b.WriteString("-")
+	} else {
+		b.WriteString(data)
+	}
+	b.WriteString(" ")
+	b.WriteString(entry.Message)
+
+	if !h.framed {
+		return b.Bytes()
+	}
+	return append([]byte(fmt.Sprintf("%d ", b.Len())), b.Bytes()...)
+}
+
+// structuredData renders the entry's fields, level and caller as one SD-ELEMENT.
+func structuredData(entry *logrus.Entry) string {
+	params := map[string]string{"level": entry.Level.String()}
+	for k, v := range entry.Data {
+		if k == logrus.ErrorKey {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+		}
+		params[sdName(k)] = fmt.Sprint(v)
+	}
+	if entry.HasCaller() {
+		params["file"] = fmt.Sprintf("%s:%d", filepath.Base(entry.Caller.File), entry.Caller.Line)
+		params["func"] = entry.Caller.Function
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("[" + structuredDataID)
+	for _, k := range keys {
+		// PARAM-VALUE escapes: '"', '\' and ']'.
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(params[k])
+		fmt.Fprintf(&b, ` %s="%s"`, k, v)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// sdName makes a field name a valid SD-NAME: printable ASCII without '=', ' ', ']' and '"', at most 32 characters.
+func sdName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// headerField makes s a valid RFC 5424 header field: printable ASCII, no spaces, "-" when empty.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
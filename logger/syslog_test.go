@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSyslogHookDoesNotBlockWhenServerIsDown(t *testing.T) {
+	// A listener that is closed again leaves a port nobody answers on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	h, err := newSyslogHook(SyslogOptions{URL: "tcp://" + addr}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	start := time.Now()
+	for i := 0; i < 2*syslogQueueSize; i++ {
+		if err := h.Fire(&logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: "hello"}); err != nil {
+			t.Fatalf("Fire: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Fire blocked for %s with the server down", elapsed)
+	}
+}
+
+func TestSyslogHookReportsDroppedEntries(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	h, err := newSyslogHook(SyslogOptions{URL: "tcp://" + ln.Addr().String()}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+	h.dropped.Store(3)
+
+	h.Fire(&logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: "after the outage"})
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var all string
+	buf := make([]byte, 4096)
+	for !strings.Contains(all, "after the outage") {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v (got %q)", err, all)
+		}
+		all += string(buf[:n])
+	}
+	if !strings.Contains(all, "3 log entries were not forwarded") {
+		t.Errorf("server received %q, want the dropped notice", all)
+	}
+	if strings.Index(all, "3 log entries") > strings.Index(all, "after the outage") {
+		t.Errorf("dropped notice should come before the entry: %q", all)
+	}
+}
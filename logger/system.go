@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SystemLogger is the platform service logger, e.g. the Windows Event Log.
+// kardianos/service's service.Logger satisfies it.
+type SystemLogger interface {
+	Error(v ...interface{}) error
+	Warning(v ...interface{}) error
+}
+
+// systemHook forwards warnings and errors to a SystemLogger. It is kept
+// across Configure calls, unlike the journald and syslog hooks.
+var systemHook *systemLoggerHook
+
+type systemLoggerHook struct {
+	sl SystemLogger
+}
+
+// UseSystemLogger sends warnings and errors to sl in addition to the
+// configured outputs, except while journald output is enabled. Call it once
+// the service is created, when running under the service manager.
+func UseSystemLogger(sl SystemLogger) {
+	systemHook = &systemLoggerHook{sl: sl}
+	installHooks()
+}
+
+// Levels implements logrus.Hook.
+func (h *systemLoggerHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+// Fire implements logrus.Hook.
+func (h *systemLoggerHook) Fire(entry *logrus.Entry) error {
+	msg := systemMessage(entry)
+	if entry.Level == logrus.WarnLevel {
+		return h.sl.Warning(msg)
+	}
+	return h.sl.Error(msg)
+}
+
+// systemMessage renders the message followed by its fields as key=value pairs.
+func systemMessage(entry *logrus.Entry) string {
+	if len(entry.Data) == 0 {
+		return entry.Message
+	}
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(entry.Message)
+	for _, k := range keys {
+		v := entry.Data[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fmt.Fprintf(&b, " %s=%v", k, v)
+	}
+	return b.String()
+}
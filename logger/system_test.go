@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeSystemLogger struct{ warnings, errors []string }
+
+func (l *fakeSystemLogger) Warning(v ...interface{}) error {
+	l.warnings = append(l.warnings, v[0].(string))
+	return nil
+}
+
+func (l *fakeSystemLogger) Error(v ...interface{}) error {
+	l.errors = append(l.errors, v[0].(string))
+	return nil
+}
+
+func TestSystemLoggerSkippedWithJournald(t *testing.T) {
+	opts := DefaultOptions(false)
+	opts.DisableFile = true
+	Configure(opts)
+	L().SetOutput(io.Discard)
+	t.Cleanup(func() {
+		systemHook = nil
+		outputHooks = nil
+		installHooks()
+	})
+
+	sl := &fakeSystemLogger{}
+	UseSystemLogger(sl)
+	L().WithField("record", 1).Warn("update failed")
+	if len(sl.warnings) != 1 || sl.warnings[0] != "update failed record=1" {
+		t.Fatalf("system logger warnings = %q, want one", sl.warnings)
+	}
+
+	// The hook is not started, so it must not receive entries here.
+	outputHooks = []outputHook{&journaldHook{}}
+	installHooks()
+	for _, h := range L().Hooks[logrus.WarnLevel] {
+		if h == systemHook {
+			t.Fatal("system logger hook is installed together with journald")
+		}
+	}
+
+	outputHooks = nil
+	installHooks()
+	L().Error("still failing")
+	if len(sl.errors) != 1 {
+		t.Errorf("system logger errors = %q after journald was disabled, want one", sl.errors)
+	}
+}
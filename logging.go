@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"ddns-dnspod/config"
+	"ddns-dnspod/logger"
+	"ddns-dnspod/servicerunner"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logFlags are command-line overrides for the [log] config table.
+type logFlags struct {
+	level  string
+	format string
+	file   string
+	dir    string
+	noFile bool
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	f := &logFlags{}
+	fs.StringVar(&f.level, "log-level", "", "Log level: trace, debug, info, warn or error")
+	fs.StringVar(&f.format, "log-format", "", "Log format: text or json")
+	fs.StringVar(&f.file, "log-file", "", "Log file path")
+	fs.StringVar(&f.dir, "log-dir", "", "Directory for the log file")
+	fs.BoolVar(&f.noFile, "no-log-file", false, "Do not write a log file")
+	return f
+}
+
+// args returns the flags that were set, so install can pass them to the service.
+func (f *logFlags) args() []string {
+	var args []string
+	for _, kv := range [][2]string{{"-log-level", f.level}, {"-log-format", f.format}, {"-log-file", f.file}, {"-log-dir", f.dir}} {
+		if kv[1] != "" {
+			args = append(args, kv[0], kv[1])
+		}
+	}
+	if f.noFile {
+		args = append(args, "-no-log-file")
+	}
+	return args
+}
+
+// loadConfig loads the configuration and registers its secrets with the log
+// redactor, so they are masked in everything logged afterwards.
+func loadConfig(configFile string, log *logrus.Logger) (config.AppConfig, error) {
+	appCfg, err := config.Load(configFile, log)
+	servicerunner.RegisterSecrets(appCfg)
+	return appCfg, err
+}
+
+// useCommandLogging sets up logging for subcommands until their config is
+// loaded: console output goes to stderr, so that stdout only carries the
+// command's result (e.g. `ip -o json`), and no log file is written before
+// the [log] table says whether and where to write one.
+func useCommandLogging() {
+	opts := logger.DefaultOptions(true)
+	opts.Stderr = true
+	opts.DisableFile = true
+	logger.Configure(opts)
+}
+
+// loadCommandConfig loads the configuration for a subcommand and applies its
+// [log] table, keeping the console output on stderr.
+func loadCommandConfig(configFile string, log *logrus.Logger) (config.AppConfig, error) {
+	appCfg, err := loadConfig(configFile, log)
+	if err != nil {
+		return appCfg, err
+	}
+	opts, optsErr := logOptions(appCfg.Log, &logFlags{}, true)
+	if optsErr == nil {
+		opts.Stderr = true
+		optsErr = logger.Configure(opts)
+	}
+	if optsErr != nil {
+		log.Warnf("Failed to apply log settings: %v", optsErr)
+	}
+	return appCfg, nil
+}
+
+// configureLogging applies the [log] table and flag overrides to the global logger.
+func configureLogging(cfg config.LogConfig, flags *logFlags, isInteractive bool) error {
+	opts, err := logOptions(cfg, flags, isInteractive)
+	if err != nil {
+		return err
+	}
+	return logger.Configure(opts)
+}
+
+// logOptions converts the [log] table and flag overrides to logger options.
+func logOptions(cfg config.LogConfig, flags *logFlags, isInteractive bool) (logger.Options, error) {
+	if flags.level != "" {
+		cfg.Level = flags.level
+	}
+	if flags.format != "" {
+		cfg.Format = flags.format
+	}
+	if flags.file != "" {
+		cfg.File = flags.file
+	}
+	if flags.dir != "" {
+		cfg.Dir = flags.dir
+	}
+	if flags.noFile {
+		cfg.DisableFile = true
+	}
+
+	opts := logger.DefaultOptions(isInteractive)
+	if cfg.Level != "" {
+		level, err := logrus.ParseLevel(cfg.Level)
+		if err != nil {
+			return opts, fmt.Errorf("invalid log level: %w", err)
+		}
+		opts.Level = level
+	}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+	case "json":
+		opts.JSON = true
+	default:
+		return opts, fmt.Errorf("invalid log format %q, use text or json", cfg.Format)
+	}
+	if cfg.Caller != nil {
+		opts.ReportCaller = *cfg.Caller
+	}
+	opts.DisableFile = cfg.DisableFile
+	opts.File = cfg.File
+	opts.Dir = cfg.Dir
+	if cfg.MaxSizeMB > 0 {
+		opts.MaxSizeMB = cfg.MaxSizeMB
+	}
+	if cfg.MaxBackups > 0 {
+		opts.MaxBackups = cfg.MaxBackups
+	}
+	if cfg.MaxAgeDays > 0 {
+		opts.MaxAgeDays = cfg.MaxAgeDays
+	}
+	opts.Compress = cfg.Compress
+	opts.Journald = cfg.Journald
+	opts.Syslog = logger.SyslogOptions{
+		URL:                cfg.Syslog.URL,
+		AppName:            cfg.Syslog.AppName,
+		Facility:           cfg.Syslog.Facility,
+		CAFile:             cfg.Syslog.CAFile,
+		CertFile:           cfg.Syslog.CertFile,
+		KeyFile:            cfg.Syslog.KeyFile,
+		InsecureSkipVerify: cfg.Syslog.InsecureSkipVerify,
+	}
+	return opts, nil
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"flag"
 	"os"
-	"strconv"
 
 	"ddns-dnspod/config"
 	"ddns-dnspod/logger"
@@ -24,55 +23,45 @@ func main() {
 
 	log := logger.L() // Get the initialized logger instance
 
-	svcConfig := &service.Config{
-		Name:        serviceName,
-		DisplayName: serviceDisplayName,
-		Description: serviceDescription,
-		// Dependencies:    []string{"After=network.target"}, // Example for systemd
-	}
-
 	// Application-specific flags
 	appFlagSet := flag.NewFlagSet(os.Args[0], flag.ContinueOnError) // ContinueOnError to handle service commands
 	configFile := appFlagSet.String("c", "", "Path to the config.toml file")
+	dryRun := appFlagSet.Bool("dry-run", false, "Detect IPs and read records, but only log the changes instead of sending them")
+	svcName := appFlagSet.String("name", serviceName, "Service name, when installed with a custom -name")
+	logOpts := addLogFlags(appFlagSet)
 
 	// The Program instance will be created after config is loaded.
 	// service.New requires a service.Interface, so we'll create Program later.
-	// For now, we prepare a placeholder or defer its creation.
+	// Service management commands (install/remove) use their own placeholder Program.
 	var prg *servicerunner.Program
 
-	// Create service controller. We pass a nil Program initially,
-	// as it needs configuration that's loaded after flag parsing.
-	// This is a bit tricky. service.New expects a non-nil service.Interface.
-	// We will create a temporary Program for service commands that don't run the core logic.
-	// For the actual run, we'll re-initialize `prg` with full config.
-
-	// A minimal program for service management commands (install/remove)
-	// that don't need full config.
-	minimalPrg := servicerunner.NewProgram(log, "", "", "", 0, 0, "", "")
-	s, err := service.New(minimalPrg, svcConfig)
-	if err != nil {
-		log.Fatalf("Failed to create service: %v", err)
-	}
-
 	// Handle service control arguments first.
 	// These arguments (install, remove, start, stop) are typically exclusive.
 	if len(os.Args) > 1 {
 		serviceAction := os.Args[1]
 		switch serviceAction {
+		case "install", "remove", "status", "config", "init", "domains", "records", "ip", "encrypt-secret":
+			useCommandLogging()
+		}
+		switch serviceAction {
 		case "install":
-			err := s.Install()
-			if err != nil {
-				log.Fatalf("Failed to install service: %v", err)
-			}
-			log.Info("Service installed successfully.")
-			return
+			os.Exit(runInstall(os.Args[2:], log))
 		case "remove":
-			err := s.Uninstall()
-			if err != nil {
-				log.Fatalf("Failed to remove service: %v", err)
-			}
-			log.Info("Service removed successfully.")
-			return
+			os.Exit(runRemove(os.Args[2:], log))
+		case "status":
+			os.Exit(runStatus(os.Args[2:], log))
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:], log))
+		case "init":
+			os.Exit(runInit(os.Args[2:], log))
+		case "domains":
+			os.Exit(runDomainsCommand(os.Args[2:], log))
+		case "records":
+			os.Exit(runRecordsCommand(os.Args[2:], log))
+		case "ip":
+			os.Exit(runIPCommand(os.Args[2:], log))
+		case "encrypt-secret":
+			os.Exit(runEncryptSecret(os.Args[2:], log))
 		case "start": // OS service manager calls this, or user manually.
 			// s.Run() will eventually call prg.Start()
 			// If called directly like `myapp.exe start`, it might just mean "run now".
@@ -109,17 +98,25 @@ func main() {
 
 	log.Info("DDNS Service Application Logic Starting/Resuming...")
 
-	appCfg, err := config.Load(*configFile, log)
+	appCfg, err := loadConfig(*configFile, log)
 	if err != nil {
-		// config.Load logs warnings but doesn't return fatal errors for missing files.
-		// We might want to be stricter here if essential configs are absent.
-		log.Errorf("Failed to load configuration: %v", err)
-		// If running as a service, this might be an issue.
-		// If interactive, the user sees the log.
+		// config.Load only fails for a file it refuses to use, such as one
+		// with readable secrets, or secrets it cannot resolve. Continuing with
+		// an empty config would only produce confusing follow-up errors.
+		// The -log-* flags still decide where this last entry is written.
+		configureLogging(config.LogConfig{}, logOpts, service.Interactive())
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if err := configureLogging(appCfg.Log, logOpts, service.Interactive()); err != nil {
+		log.Errorf("Failed to apply log settings: %v", err)
+	}
+	if path := logger.FilePath(); path != "" {
+		log.Infof("Logging to %s", path)
 	}
 
-	if appCfg.SecretID == "" || appCfg.SecretKey == "" || appCfg.Domain == "" || (appCfg.RecordIDIPv4 == "" && appCfg.RecordIDIPv6 == "") {
-		log.Error("Critical configuration (SecretID, SecretKey, Domain, and at least one of RecordIDIPv4 or RecordIDIPv6) is missing or incomplete.")
+	if (appCfg.NeedsSecretKeys() && (appCfg.SecretID == "" || appCfg.SecretKey == "")) || appCfg.Domain == "" || !appCfg.HasRecords() {
+		log.Error("Critical configuration (SecretID, SecretKey, Domain, and at least one of RecordIDIPv4, RecordIDIPv6 or a [[record]] table) is missing or incomplete.")
 		if service.Interactive() {
 			log.Info("Please ensure configuration is set via config.toml or environment variables.")
 			os.Exit(1) // Exit if interactive and config is bad
@@ -128,49 +125,60 @@ func main() {
 		// The service might fail to start properly.
 	}
 
-	var recordIdIPv4Int64 int64
-	if appCfg.RecordIDIPv4 != "" {
-		recordIdIPv4Int64, err = strconv.ParseInt(appCfg.RecordIDIPv4, 10, 64)
-		if err != nil {
-			log.Fatalf("无法将 RecordIDIPv4 (%s) 转换为 int64: %v", appCfg.RecordIDIPv4, err)
-		}
-	} else {
+	if appCfg.RecordIDIPv4 == "" {
 		log.Warn("DNSPOD_RECORDID_IPV4 is not set. IPv4 updates will be skipped if not running as a service and this is the only ID missing.")
 	}
-
-	var recordIdIPv6Int64 int64
-	if appCfg.RecordIDIPv6 != "" {
-		recordIdIPv6Int64, err = strconv.ParseInt(appCfg.RecordIDIPv6, 10, 64)
-		if err != nil {
-			log.Fatalf("无法将 RecordIDIPv6 (%s) 转换为 int64: %v", appCfg.RecordIDIPv6, err)
-		}
-	} else {
+	if appCfg.RecordIDIPv6 == "" {
 		log.Warn("DNSPOD_RECORDID_IPV6 is not set. IPv6 updates will be skipped if not running as a service and this is the only ID missing.")
 	}
+	if !appCfg.HasRecords() && !service.Interactive() {
+		// If running as a service and BOTH RecordIDs are unset.
+		log.Error("Neither DNSPOD_RECORDID_IPV4 nor DNSPOD_RECORDID_IPV6 nor any [[record]] is set. Service cannot perform any DNS updates.")
+	}
 
-	if recordIdIPv4Int64 == 0 && recordIdIPv6Int64 == 0 && !service.Interactive() {
-		// If running as a service and BOTH RecordIDs are effectively zero/unset.
-		log.Error("Neither DNSPOD_RECORDID_IPV4 nor DNSPOD_RECORDID_IPV6 is set. Service cannot perform any DNS updates.")
+	updateCfg, interval, err := servicerunner.BuildUpdateConfig(appCfg)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	updateCfg.DryRun = *dryRun
+	if err := servicerunner.UseProxies(appCfg); err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	if err := servicerunner.UseCredentials(appCfg); err != nil {
+		log.Fatalf("Failed to set up credentials: %v", err)
 	}
 
 	// Now create the actual Program with loaded configuration
-	prg = servicerunner.NewProgram(log, appCfg.SecretID, appCfg.SecretKey, appCfg.Domain, recordIdIPv4Int64, recordIdIPv6Int64, appCfg.SubDomainIPv4, appCfg.SubDomainIPv6)
+	prg = servicerunner.NewProgram(log, updateCfg, interval)
+	prg.WatchConfig(*configFile, appCfg)
+
+	statePath := appCfg.StateFile
+	if statePath == "" {
+		if statePath, err = servicerunner.DefaultStatePath(*svcName); err != nil {
+			log.Warnf("Cannot determine the state file location, `status` will not show results: %v", err)
+		}
+	}
+	prg.SetStatePath(statePath)
 
-	// Update the service with the fully configured program
-	// This is a common pattern: create service with a placeholder, then update its interface.
-	// However, kardianos/service.New takes the interface at creation.
-	// So, we need to create a new service instance if we want to pass the fully configured `prg`.
-	// Or, ensure `minimalPrg` can be updated, but `service.Interface` is not directly mutable on `s`.
-	// The simplest is to re-create `s` if `prg` is different from `minimalPrg`.
-	// But since `install`/`remove` exit, for the `run` path, we can create `s` here.
+	// kardianos/service.New takes the interface at creation, so the service
+	// is only created once the fully configured `prg` exists.
 
 	// If we reached here, it's not an install/remove command.
 	// We are either running directly or being started as a service.
 	// Create the service with the fully configured program.
-	s, err = service.New(prg, svcConfig)
+	s, err := service.New(prg, newServiceConfig(*svcName))
 	if err != nil {
 		log.Fatalf("Failed to create service with full config: %v", err)
 	}
+	if !service.Interactive() {
+		// Under the service manager, also surface warnings and errors where
+		// administrators look first, e.g. the Windows Event Log.
+		if sysLog, err := s.Logger(nil); err != nil {
+			log.Warnf("System service logger is not available: %v", err)
+		} else {
+			logger.UseSystemLogger(sysLog)
+		}
+	}
 
 	// Log effective configuration being used by the service runner
 	log.Infof("Service will run with DNSPOD_DOMAIN: %s", prg.GetDomain())
@@ -184,7 +192,22 @@ func main() {
 	} else {
 		log.Info("DNSPOD_RECORDID_IPV6: Not set or invalid, IPv6 updates will be skipped.")
 	}
-	log.Infof("DNSPOD_SECRET_ID is set: %t", prg.GetSecretID() != "")
+	for _, rec := range updateCfg.Records {
+		log.Infof("Record %d: SUBDOMAIN %s, type %s, line %q, IP from %v", rec.RecordID, rec.SubDomain, rec.Type, rec.Options.Line, rec.Sources)
+	}
+	if appCfg.NeedsSecretKeys() {
+		log.Infof("DNSPOD_SECRET_ID is set: %t", prg.GetSecretID() != "")
+	}
+	if appCfg.CredentialSource != "" {
+		log.Infof("Credential source: %s", appCfg.CredentialSource)
+	}
+	if appCfg.Proxy.API.URL != "" || appCfg.Proxy.IPDetection.URL != "" {
+		log.Infof("API proxy: %s; IP detection proxy: %s", appCfg.Proxy.API.Settings(), appCfg.Proxy.IPDetection.Settings())
+	}
+	log.Infof("Update interval: %s", prg.GetInterval())
+	if *dryRun {
+		log.Warn("Dry-run mode: records will be read but no changes will be sent to DNSPod.")
+	}
 
 	err = s.Run()
 	if err != nil {
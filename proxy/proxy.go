@@ -0,0 +1,140 @@
+// Package proxy selects the outbound proxy for IP detection and for the
+// DNSPod API, which are configured separately: detecting the address through
+// a proxy reports the proxy's address, so it is normally reached directly.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Direct disables proxies, including HTTP_PROXY/HTTPS_PROXY from the environment.
+const Direct = "direct"
+
+// Settings is a proxy URL and the hosts that bypass it.
+type Settings struct {
+	// URL is http://, https://, socks5:// or socks5h://, with optional
+	// user:password@ for authentication. Empty uses HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY from the environment, Direct uses no proxy at all.
+	URL string
+	// NoProxy lists hosts reached directly: "*", host names (also matching
+	// subdomains; a leading dot is optional), IP addresses and CIDR ranges.
+	NoProxy []string
+}
+
+// Parse checks a proxy URL. It returns nil for "" and Direct.
+func Parse(raw string) (*url.URL, error) {
+	if raw == "" || raw == Direct {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Error includes the URL, and with it the password.
+		return nil, fmt.Errorf("invalid proxy URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy scheme %q must be http, https, socks5 or socks5h", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL %s has no host", u.Redacted())
+	}
+	return u, nil
+}
+
+// CheckNoProxy checks a NoProxy entry.
+func CheckNoProxy(entry string) error {
+	switch {
+	case entry == "":
+		return fmt.Errorf("empty entry")
+	case strings.Contains(entry, "/"):
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("%q is not a valid CIDR range", entry)
+		}
+	case strings.ContainsAny(entry, " :") && net.ParseIP(entry) == nil:
+		return fmt.Errorf("%q must be a host name, IP address or CIDR range, without a port", entry)
+	}
+	return nil
+}
+
+// Password returns the password in a proxy URL, so it can be masked in logs.
+func Password(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return password
+}
+
+// Func returns the function to use as http.Transport.Proxy. It is
+// http.ProxyFromEnvironment when s.URL is empty.
+func (s Settings) Func() (func(*http.Request) (*url.URL, error), error) {
+	if s.URL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+	for _, entry := range s.NoProxy {
+		if err := CheckNoProxy(entry); err != nil {
+			return nil, fmt.Errorf("no_proxy: %w", err)
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if s.bypass(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+// String describes s for logs, with the password masked.
+func (s Settings) String() string {
+	if u, err := Parse(s.URL); err == nil && u != nil {
+		return u.Redacted()
+	}
+	if s.URL == "" {
+		return "from environment"
+	}
+	return s.URL
+}
+
+// bypass reports whether host is reached without the proxy. Like
+// http.ProxyFromEnvironment, loopback addresses never use the proxy.
+func (s Settings) bypass(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, entry := range s.NoProxy {
+		entry = strings.ToLower(entry)
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+				return true
+			}
+		case ip != nil:
+			if entryIP := net.ParseIP(entry); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+		default:
+			domain := strings.TrimPrefix(entry, ".")
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,9 +1,11 @@
 package servicerunner
 
 import (
-	"fmt"
+	"errors"
+	"os"
 	"time"
 
+	"ddns-dnspod/config"
 	"ddns-dnspod/dnspod" // Assuming module path allows this
 
 	"github.com/kardianos/service"
@@ -12,45 +14,50 @@ import (
 
 // Program implements service.Interface
 type Program struct {
-	logger        *logrus.Logger
-	ticker        *time.Ticker
-	quit          chan struct{}
-	secretID      string
-	secretKey     string
-	domain        string
-	recordIDIPv4  int64
-	recordIDIPv6  int64
-	subDomainIPv4 string
-	subDomainIPv6 string
+	logger   *logrus.Logger
+	ticker   *time.Ticker
+	quit     chan struct{}
+	done     chan struct{}
+	cfg      dnspod.UpdateConfig
+	interval time.Duration
+
+	// Hot reload state, set by WatchConfig and only touched by the update goroutine afterwards.
+	configFileArg string
+	configPath    string
+	configSum     []byte
+	appCfg        config.AppConfig
+	hup           <-chan os.Signal // SIGHUP, subscribed by WatchConfig
+	stopHup       func()
+
+	statePath string
+	state     State
 }
 
 // NewProgram creates a new Program instance.
-func NewProgram(logger *logrus.Logger, secretID, secretKey, domain string, recordIDIPv4, recordIDIPv6 int64, subDomainIPv4, subDomainIPv6 string) *Program {
+func NewProgram(logger *logrus.Logger, cfg dnspod.UpdateConfig, interval time.Duration) *Program {
+	if interval <= 0 {
+		interval = config.DefaultInterval
+	}
 	return &Program{
-		logger:        logger,
-		secretID:      secretID,
-		secretKey:     secretKey,
-		domain:        domain,
-		recordIDIPv4:  recordIDIPv4,
-		recordIDIPv6:  recordIDIPv6,
-		subDomainIPv4: subDomainIPv4,
-		subDomainIPv6: subDomainIPv6,
+		logger:   logger,
+		cfg:      cfg,
+		interval: interval,
 	}
 }
 
 // Start is called when the service is started.
 func (p *Program) Start(s service.Service) error {
 	p.logger.Info("Service starting...")
-	if p.secretID == "" || p.secretKey == "" || p.domain == "" || (p.recordIDIPv4 == 0 && p.recordIDIPv6 == 0) {
+	if !p.cfg.HasCredentials() || p.cfg.Domain == "" || (p.cfg.RecordIDIPv4 == 0 && p.cfg.RecordIDIPv6 == 0 && len(p.cfg.Records) == 0) {
 		errMsg := "Critical configuration missing (SecretID, SecretKey, Domain, or at least one RecordID for IPv4/IPv6). Service cannot start effectively."
 		p.logger.Error(errMsg)
 		// Optionally, return an error to prevent the service from starting if config is invalid
-		return fmt.Errorf(errMsg)
+		return errors.New(errMsg)
 	}
-	if p.recordIDIPv4 == 0 {
+	if p.cfg.RecordIDIPv4 == 0 {
 		p.logger.Warn("RecordID for IPv4 is not set. IPv4 DDNS updates will be skipped.")
 	}
-	if p.recordIDIPv6 == 0 {
+	if p.cfg.RecordIDIPv6 == 0 {
 		p.logger.Warn("RecordID for IPv6 is not set. IPv6 DDNS updates will be skipped.")
 	}
 
@@ -58,23 +65,12 @@ func (p *Program) Start(s service.Service) error {
 
 	// Initial run
 	p.logger.Info("Performing initial DNS update...")
-	dnspod.UpdateAndModifyRecords(p.secretID, p.secretKey, p.domain, p.recordIDIPv4, p.recordIDIPv6, p.subDomainIPv4, p.subDomainIPv6, p.logger)
-
-	p.ticker = time.NewTicker(5 * time.Minute)
-	go func() {
-		p.logger.Info("Background DNS update goroutine started.")
-		for {
-			select {
-			case <-p.ticker.C:
-				p.logger.Info("Scheduled DNS update triggered by ticker.")
-				dnspod.UpdateAndModifyRecords(p.secretID, p.secretKey, p.domain, p.recordIDIPv4, p.recordIDIPv6, p.subDomainIPv4, p.subDomainIPv6, p.logger)
-			case <-p.quit:
-				p.ticker.Stop()
-				p.logger.Info("Ticker stopped, background goroutine exiting.")
-				return
-			}
-		}
-	}()
+	p.state = State{PID: os.Getpid(), StartedAt: time.Now(), DryRun: p.cfg.DryRun}
+	p.runUpdate()
+
+	p.ticker = time.NewTicker(p.interval)
+	p.done = make(chan struct{})
+	go p.loop()
 	p.logger.Info("Service started successfully.")
 	return nil
 }
@@ -84,44 +80,107 @@ func (p *Program) Stop(s service.Service) error {
 	p.logger.Info("Service stopping...")
 	if p.quit != nil {
 		close(p.quit)
+		<-p.done
+	}
+	if p.stopHup != nil {
+		p.stopHup()
 	}
 	// Add any other cleanup logic here
 	p.logger.Info("Service stopped.")
 	return nil
 }
 
+// SetStatePath sets where the outcome of each update cycle is persisted.
+// An empty path disables persistence.
+func (p *Program) SetStatePath(path string) {
+	p.statePath = path
+}
+
+// runUpdate performs one update cycle and persists its outcome.
+func (p *Program) runUpdate() {
+	result := dnspod.UpdateAndModifyRecords(p.cfg, p.logger)
+	p.state.record(result, time.Now())
+	if p.statePath == "" {
+		return
+	}
+	if err := p.state.Save(p.statePath); err != nil {
+		p.logger.Warnf("Failed to save state to %s: %v", p.statePath, err)
+	}
+}
+
+// loop runs scheduled updates and config reloads until Stop is called.
+// Reloads happen here, between update cycles, so a new configuration is
+// swapped in atomically with respect to updates.
+func (p *Program) loop() {
+	defer close(p.done)
+	p.logger.Infof("Background DNS update goroutine started (interval %s).", p.interval)
+
+	var watch <-chan time.Time
+	if p.configPath != "" {
+		watchTicker := time.NewTicker(configPollInterval)
+		defer watchTicker.Stop()
+		watch = watchTicker.C
+		p.logger.Infof("Watching %s for changes.", p.configPath)
+	}
+
+	for {
+		select {
+		case <-p.ticker.C:
+			p.logger.Info("Scheduled DNS update triggered by ticker.")
+			p.runUpdate()
+		case <-p.hup:
+			if p.configPath != "" && p.reload("SIGHUP") {
+				p.runUpdate()
+			}
+		case <-watch:
+			if p.configChanged() && p.reload("file changed") {
+				p.runUpdate()
+			}
+		case <-p.quit:
+			p.ticker.Stop()
+			p.logger.Info("Ticker stopped, background goroutine exiting.")
+			return
+		}
+	}
+}
+
 // GetDomain returns the configured domain.
 func (p *Program) GetDomain() string {
-	return p.domain
+	return p.cfg.Domain
 }
 
 // GetRecordIDIPv4 returns the configured IPv4 Record ID.
 func (p *Program) GetRecordIDIPv4() int64 {
-	return p.recordIDIPv4
+	return p.cfg.RecordIDIPv4
 }
 
 // GetRecordIDIPv6 returns the configured IPv6 Record ID.
 func (p *Program) GetRecordIDIPv6() int64 {
-	return p.recordIDIPv6
+	return p.cfg.RecordIDIPv6
 }
 
 // GetSubDomainIPv4 returns the configured IPv4 SubDomain.
 func (p *Program) GetSubDomainIPv4() string {
-	if p.subDomainIPv4 == "" {
+	if p.cfg.SubDomainIPv4 == "" {
 		return "@" // Default to root if not specified
 	}
-	return p.subDomainIPv4
+	return p.cfg.SubDomainIPv4
 }
 
 // GetSubDomainIPv6 returns the configured IPv6 SubDomain.
 func (p *Program) GetSubDomainIPv6() string {
-	if p.subDomainIPv6 == "" {
+	if p.cfg.SubDomainIPv6 == "" {
 		return "@" // Default to root if not specified
 	}
-	return p.subDomainIPv6
+	return p.cfg.SubDomainIPv6
+}
+
+// GetInterval returns the configured update interval.
+func (p *Program) GetInterval() time.Duration {
+	return p.interval
 }
 
 // GetSecretID returns the configured Secret ID.
 func (p *Program) GetSecretID() string {
-	return p.secretID
+	return p.cfg.SecretID
 }
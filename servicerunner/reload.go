@@ -0,0 +1,147 @@
+package servicerunner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"ddns-dnspod/config"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+// Polling avoids a file-notification dependency and copes with editors that
+// replace the file instead of writing it in place.
+const configPollInterval = 5 * time.Second
+
+// WatchConfig makes the running Program reload its configuration when the
+// file config.Load reads for configFileArg changes, or on SIGHUP where supported.
+// current is the configuration the Program was built from, used to log diffs.
+func (p *Program) WatchConfig(configFileArg string, current config.AppConfig) {
+	// Subscribe now rather than in loop: Start runs the first update before
+	// the loop, and an unhandled SIGHUP in the meantime would kill the process.
+	// A signal received until then is buffered and handled by the loop.
+	if p.hup == nil {
+		p.hup, p.stopHup = notifyReload()
+	}
+	p.configFileArg = configFileArg
+	p.appCfg = current
+	path, err := config.ResolvePath(configFileArg)
+	if err != nil {
+		p.logger.Warnf("Config hot reload disabled: %v", err)
+		return
+	}
+	p.configPath = path
+	p.configSum = fileSum(path)
+}
+
+// configChanged reports whether the watched file's content differs from the last load.
+func (p *Program) configChanged() bool {
+	if p.configPath == "" {
+		return false
+	}
+	sum := fileSum(p.configPath)
+	return sum != nil && !bytes.Equal(sum, p.configSum)
+}
+
+// reload loads and validates the configuration again and swaps it in.
+// It runs on the update goroutine, so the swap never races with an update cycle.
+// It returns true when a new configuration was applied.
+func (p *Program) reload(reason string) bool {
+	p.logger.Infof("Reloading configuration (%s)...", reason)
+	p.configSum = fileSum(p.configPath)
+
+	if _, statErr := os.Stat(p.configPath); statErr == nil {
+		if _, err := config.Decode(p.configPath); err != nil {
+			p.logger.Errorf("Rejected config reload: %s cannot be parsed: %v. Keeping the current configuration.", p.configPath, err)
+			return false
+		}
+	}
+	newAppCfg, err := config.Load(p.configFileArg, p.logger)
+	if err != nil {
+		p.logger.Errorf("Rejected config reload: %v. Keeping the current configuration.", err)
+		return false
+	}
+	RegisterSecrets(newAppCfg)
+
+	diff := config.Diff(p.appCfg, newAppCfg)
+	if len(diff) == 0 {
+		p.logger.Info("Configuration unchanged.")
+		return false
+	}
+	diffText := "\n  " + strings.Join(diff, "\n  ")
+
+	var problems []string
+	for _, r := range newAppCfg.Validate() {
+		if r.Status == config.StatusError {
+			problems = append(problems, fmt.Sprintf("%s: %s", r.Field, r.Message))
+		}
+	}
+	newCfg, interval, err := BuildUpdateConfig(newAppCfg)
+	if err != nil && len(problems) == 0 {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		p.logger.Errorf("Rejected config reload, keeping the current configuration. Errors:\n  %s\nChanges that were not applied:%s",
+			strings.Join(problems, "\n  "), diffText)
+		return false
+	}
+
+	// Credentials are set up through the new proxies (STS and CVM role
+	// credentials make requests), so the proxies are swapped first and put
+	// back if the credentials fail, leaving the old configuration intact.
+	proxiesChanged := !reflect.DeepEqual(p.appCfg.Proxy, newAppCfg.Proxy)
+	if proxiesChanged {
+		if err := UseProxies(newAppCfg); err != nil {
+			p.logger.Errorf("Rejected config reload, keeping the current configuration: %v\nChanges that were not applied:%s", err, diffText)
+			return false
+		}
+	}
+	if credentialsChanged(p.appCfg, newAppCfg) {
+		if err := UseCredentials(newAppCfg); err != nil {
+			if proxiesChanged {
+				if restoreErr := UseProxies(p.appCfg); restoreErr != nil {
+					p.logger.Errorf("Failed to restore the previous proxy settings: %v", restoreErr)
+				}
+			}
+			p.logger.Errorf("Rejected config reload, keeping the current configuration: %v\nChanges that were not applied:%s", err, diffText)
+			return false
+		}
+	}
+
+	newCfg.DryRun = p.cfg.DryRun // Command-line flags are not part of the file
+	if newAppCfg.StateFile != "" && newAppCfg.StateFile != p.appCfg.StateFile {
+		p.statePath = newAppCfg.StateFile
+	}
+	oldLog := p.appCfg.Log
+	p.cfg = newCfg
+	p.appCfg = newAppCfg
+	if interval != p.interval {
+		p.interval = interval
+		p.ticker.Reset(interval)
+	}
+	p.logger.Infof("Configuration reloaded. Changes:%s", diffText)
+	if !reflect.DeepEqual(newAppCfg.Log, oldLog) {
+		p.logger.Warn("[log] settings changed; they take effect after a restart.")
+	}
+	return true
+}
+
+// credentialsChanged reports whether the settings read by UseCredentials differ.
+func credentialsChanged(old, new config.AppConfig) bool {
+	return old.CredentialSource != new.CredentialSource || old.SecretID != new.SecretID || old.SecretKey != new.SecretKey ||
+		old.CVMRoleName != new.CVMRoleName || old.MetadataURL != new.MetadataURL ||
+		old.STSRoleArn != new.STSRoleArn || old.STSSessionName != new.STSSessionName || old.STSDuration != new.STSDuration
+}
+
+func fileSum(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,175 @@
+package servicerunner
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ddns-dnspod/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+)
+
+// testConfig is a complete config whose IP source fails at once, so an
+// update cycle triggered by a reload never reaches the DNSPod API.
+const testConfig = `DNSPOD_SECRET_ID = "AKIDtest"
+DNSPOD_SECRET_KEY = "test-secret-key"
+DNSPOD_DOMAIN = "%s"
+DNSPOD_RECORDID_IPV4 = "1"
+IP_SOURCES_IPV4 = ["http://127.0.0.1:1/"]
+`
+
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newWatchedProgram returns a Program built from the config at path, as main does.
+func newWatchedProgram(t *testing.T, path string) (*Program, *test.Hook) {
+	t.Helper()
+	log, hook := test.NewNullLogger()
+	log.SetLevel(logrus.DebugLevel)
+	appCfg, err := config.Load(path, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, interval, err := BuildUpdateConfig(appCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProgram(log, cfg, interval)
+	p.ticker = time.NewTicker(time.Hour)
+	t.Cleanup(p.ticker.Stop)
+	p.WatchConfig(path, appCfg)
+	t.Cleanup(func() {
+		if p.stopHup != nil {
+			p.stopHup()
+		}
+	})
+	return p, hook
+}
+
+func TestReloadOnChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.com", 1))
+	p, _ := newWatchedProgram(t, path)
+
+	if p.configChanged() {
+		t.Fatal("configChanged() is true before the file was touched")
+	}
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.org", 1)+"UPDATE_INTERVAL = \"10m\"\n")
+	if !p.configChanged() {
+		t.Fatal("configChanged() is false after the file changed")
+	}
+	if !p.reload("file changed") {
+		t.Fatal("reload() = false, want the new configuration applied")
+	}
+	if p.cfg.Domain != "example.org" || p.interval != 10*time.Minute {
+		t.Errorf("after reload: domain %q, interval %s", p.cfg.Domain, p.interval)
+	}
+	if p.configChanged() {
+		t.Error("configChanged() is still true after the reload")
+	}
+}
+
+func TestReloadKeepsConfigOnErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, content, wantLog string
+	}{
+		{"syntax error", "DNSPOD_DOMAIN = \"example.org\n", "cannot be parsed"},
+		{"validation error", strings.Replace(testConfig, "%s", "example.org", 1) + "UPDATE_INTERVAL = \"1s\"\n", "UPDATE_INTERVAL"},
+		{"readable secrets", "", "readable by other users"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.com", 1))
+			p, hook := newWatchedProgram(t, path)
+			before := p.cfg
+
+			if tt.content == "" {
+				// Same content, but now readable by the group.
+				writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.org", 1))
+				if err := os.Chmod(path, 0640); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeTestConfig(t, path, tt.content)
+			}
+			if p.reload("file changed") {
+				t.Fatal("reload() = true for an invalid configuration")
+			}
+			if p.cfg.Domain != before.Domain || p.interval != config.DefaultInterval {
+				t.Errorf("configuration changed to domain %q, interval %s", p.cfg.Domain, p.interval)
+			}
+			if entry := hook.LastEntry(); entry == nil || entry.Level != logrus.ErrorLevel || !strings.Contains(entry.Message, tt.wantLog) {
+				t.Errorf("last log entry = %v, want an error mentioning %q", entry, tt.wantLog)
+			}
+			// The rejected file is not retried until it changes again.
+			if p.configChanged() {
+				t.Error("configChanged() is true for the rejected file")
+			}
+		})
+	}
+}
+
+// waitForLog waits until hook has an entry containing msg.
+func waitForLog(t *testing.T, hook *test.Hook, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, entry := range hook.AllEntries() {
+			if strings.Contains(entry.Message, msg) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var logged []string
+	for _, entry := range hook.AllEntries() {
+		logged = append(logged, entry.Message)
+	}
+	t.Fatalf("no log entry containing %q; got:\n%s", msg, strings.Join(logged, "\n"))
+}
+
+// startLoop runs p's update loop until the test ends.
+func startLoop(t *testing.T, p *Program) {
+	p.quit = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.loop()
+	t.Cleanup(func() {
+		close(p.quit)
+		<-p.done
+	})
+}
+
+func TestReloadRestoresProxiesWhenCredentialsFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.com", 1)+"[proxy.api]\nurl = \"http://old-proxy:3128\"\n")
+	p, hook := newWatchedProgram(t, path)
+	if err := UseProxies(p.appCfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UseProxies(config.AppConfig{}) })
+
+	// The CVM role credentials cannot be fetched, so the reload is rejected
+	// after the new proxy has already been put in place.
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.org", 1)+
+		"CREDENTIAL_SOURCE = \"cvm_role\"\nMETADATA_URL = \"http://127.0.0.1:1/\"\n[proxy.api]\nurl = \"http://new-proxy:3128\"\n")
+	if p.reload("file changed") {
+		t.Fatal("reload() = true although the credentials failed")
+	}
+	waitForLog(t, hook, "CVM role credentials")
+
+	req, _ := http.NewRequest(http.MethodPost, "https://dnspod.tencentcloudapi.com/", nil)
+	u, err := common.DefaultHttpClient.Transport.(*http.Transport).Proxy(req)
+	if err != nil || u == nil || u.Host != "old-proxy:3128" {
+		t.Errorf("API proxy after the rejected reload = %v, %v; want the previous http://old-proxy:3128", u, err)
+	}
+}
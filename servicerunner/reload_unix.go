@@ -0,0 +1,16 @@
+//go:build !windows
+
+package servicerunner
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload returns a channel that receives SIGHUP, the conventional reload signal.
+func notifyReload() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch, func() { signal.Stop(ch) }
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package servicerunner
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.com", 1))
+	p, hook := newWatchedProgram(t, path)
+	writeTestConfig(t, path, strings.Replace(testConfig, "%s", "example.org", 1))
+
+	// The signal arrives before the loop runs, as it may during the first
+	// update in Start; WatchConfig has subscribed, so it is kept, not fatal.
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	startLoop(t, p)
+	waitForLog(t, hook, "Reloading configuration (SIGHUP)")
+	waitForLog(t, hook, "Configuration reloaded")
+}
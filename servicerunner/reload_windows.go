@@ -0,0 +1,12 @@
+//go:build windows
+
+package servicerunner
+
+import (
+	"os"
+)
+
+// notifyReload returns a nil channel: Windows has no SIGHUP, so only file changes trigger reloads.
+func notifyReload() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
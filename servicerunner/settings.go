@@ -0,0 +1,248 @@
+package servicerunner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ddns-dnspod/config"
+	"ddns-dnspod/dnspod"
+	"ddns-dnspod/ipfetcher"
+	"ddns-dnspod/logger"
+)
+
+// BuildUpdateConfig converts a loaded AppConfig into the settings used by the update loop.
+// Missing record IDs are allowed (that family is skipped); malformed values are errors.
+func BuildUpdateConfig(appCfg config.AppConfig) (dnspod.UpdateConfig, time.Duration, error) {
+	cfg := dnspod.UpdateConfig{
+		SecretID:      appCfg.SecretID,
+		SecretKey:     appCfg.SecretKey,
+		Domain:        appCfg.Domain,
+		SubDomainIPv4: appCfg.SubDomainIPv4,
+		SubDomainIPv6: appCfg.SubDomainIPv6,
+	}
+
+	var err error
+	if cfg.IPv4Sources, err = ipSources(appCfg, appCfg.IPSourcesIPv4, ipfetcher.Binding{Family: ipfetcher.IPv4}); err != nil {
+		return cfg, 0, fmt.Errorf("IP_SOURCES_IPV4: %w", err)
+	}
+	if cfg.IPv6Sources, err = ipSources(appCfg, appCfg.IPSourcesIPv6, ipfetcher.Binding{Family: ipfetcher.IPv6}); err != nil {
+		return cfg, 0, fmt.Errorf("IP_SOURCES_IPV6: %w", err)
+	}
+	if appCfg.RecordIDIPv4 != "" {
+		if cfg.RecordIDIPv4, err = config.ParseRecordID(appCfg.RecordIDIPv4); err != nil {
+			return cfg, 0, fmt.Errorf("DNSPOD_RECORDID_IPV4: %w", err)
+		}
+	}
+	if appCfg.RecordIDIPv6 != "" {
+		if cfg.RecordIDIPv6, err = config.ParseRecordID(appCfg.RecordIDIPv6); err != nil {
+			return cfg, 0, fmt.Errorf("DNSPOD_RECORDID_IPV6: %w", err)
+		}
+	}
+	if appCfg.TTL < 0 || appCfg.TTL > config.MaxTTL {
+		return cfg, 0, fmt.Errorf("DNSPOD_TTL %d is outside the range %d-%d", appCfg.TTL, config.MinTTL, config.MaxTTL)
+	}
+	if cfg.IPv4Options, err = recordOptions(appCfg, "DNSPOD_*_IPV4", appCfg.LineIPv4, appCfg.TTLIPv4, appCfg.WeightIPv4, appCfg.RemarkIPv4); err != nil {
+		return cfg, 0, err
+	}
+	if cfg.IPv6Options, err = recordOptions(appCfg, "DNSPOD_*_IPV6", appCfg.LineIPv6, appCfg.TTLIPv6, appCfg.WeightIPv6, appCfg.RemarkIPv6); err != nil {
+		return cfg, 0, err
+	}
+	for i, rec := range appCfg.Records {
+		label := fmt.Sprintf("record[%d]", i)
+		if rec.RecordID <= 0 {
+			return cfg, 0, fmt.Errorf("%s: record_id must be a positive record ID", label)
+		}
+		opts, err := recordOptions(appCfg, label, rec.Line, rec.TTL, rec.Weight, rec.Remark)
+		if err != nil {
+			return cfg, 0, err
+		}
+		binding := ipfetcher.Binding{Interface: rec.Interface, SourceAddress: rec.SourceAddress, Family: ipfetcher.IPv4}
+		if rec.RecordType() == "AAAA" {
+			binding.Family = ipfetcher.IPv6
+		}
+		sources, err := ipSources(appCfg, rec.IPSources, binding)
+		if err != nil {
+			return cfg, 0, fmt.Errorf("%s: %w", label, err)
+		}
+		cfg.Records = append(cfg.Records, dnspod.RecordConfig{
+			RecordID:  rec.RecordID,
+			SubDomain: rec.SubDomain,
+			Type:      rec.RecordType(),
+			Options:   opts,
+			Sources:   sources,
+		})
+	}
+
+	interval, err := appCfg.UpdateInterval()
+	if err != nil {
+		return cfg, 0, err
+	}
+	return cfg, interval, nil
+}
+
+// ipSources resolves IP_SOURCES_* or ip_sources entries: URLs, stun: URIs and
+// presets are bound with binding, [[ip_source]] names use their own route but binding's
+// family.
+// No entries means the built-in source for the family.
+func ipSources(appCfg config.AppConfig, entries []string, binding ipfetcher.Binding) ([]ipfetcher.Source, error) {
+	if len(entries) == 0 {
+		entries = []string{ipfetcher.IPv4URL}
+		if binding.Family == ipfetcher.IPv6 {
+			entries = []string{ipfetcher.IPv6URL}
+		}
+	}
+	sources := make([]ipfetcher.Source, 0, len(entries))
+	for _, entry := range entries {
+		named, ok := appCfg.NamedSource(entry)
+		if !ok {
+			if preset, ok := ipfetcher.Preset(entry, binding); ok {
+				sources = append(sources, preset)
+			} else if server, ok := strings.CutPrefix(entry, "stun:"); ok {
+				sources = append(sources, ipfetcher.STUNSource{Servers: []string{server}, Binding: binding})
+			} else {
+				sources = append(sources, ipfetcher.HTTPSource{URL: entry, Binding: binding})
+			}
+			continue
+		}
+		family, err := ipfetcher.ParseFamily(named.Family)
+		if err != nil {
+			return nil, fmt.Errorf("ip_source %s: %w", named.Name, err)
+		}
+		if family != ipfetcher.AnyFamily && family != binding.Family {
+			return nil, fmt.Errorf("ip_source %s is %s but is used for %s", named.Name, family, binding.Family)
+		}
+		namedBinding := ipfetcher.Binding{
+			Interface:     named.Interface,
+			SourceAddress: named.SourceAddress,
+			Family:        binding.Family,
+		}
+		switch named.SourceType() {
+		case "http":
+			sources = append(sources, ipfetcher.HTTPSource{Name: named.Name, URL: named.URL, Binding: namedBinding})
+		case "dns":
+			sources = append(sources, ipfetcher.DNSSource{
+				Name:      named.Name,
+				Resolvers: named.Resolvers,
+				QueryName: named.QueryName,
+				QueryType: named.QueryType,
+				Binding:   namedBinding,
+			})
+		case "stun":
+			sources = append(sources, ipfetcher.STUNSource{Name: named.Name, Servers: named.Servers, Binding: namedBinding})
+		case ipfetcher.RouterUPnP, ipfetcher.RouterNATPMP, ipfetcher.RouterPCP:
+			sources = append(sources, ipfetcher.RouterSource{
+				Name:        named.Name,
+				Protocol:    named.SourceType(),
+				Gateway:     named.Gateway,
+				ControlURL:  named.ControlURL,
+				SSDPAddress: named.SSDPAddress,
+				Binding:     namedBinding,
+			})
+		case "ubus":
+			sources = append(sources, ipfetcher.UbusSource{
+				Name:         named.Name,
+				URL:          named.URL,
+				Username:     named.Username,
+				Password:     named.Password,
+				WANInterface: named.WANInterface,
+				JSONPath:     named.JSONPath,
+				Binding:      namedBinding,
+			})
+		case "page":
+			sources = append(sources, ipfetcher.PageSource{
+				Name:     named.Name,
+				URL:      named.URL,
+				Username: named.Username,
+				Password: named.Password,
+				Headers:  named.Headers,
+				JSONPath: named.JSONPath,
+				Regex:    named.Regex,
+				Binding:  namedBinding,
+			})
+		case "command":
+			timeout, err := named.CommandTimeout()
+			if err != nil {
+				return nil, fmt.Errorf("ip_source %s: timeout %w", named.Name, err)
+			}
+			sources = append(sources, ipfetcher.CommandSource{Name: named.Name, Command: named.Command, Timeout: timeout, Binding: namedBinding})
+		case "metadata":
+			sources = append(sources, ipfetcher.MetadataSource{
+				Name:     named.Name,
+				Provider: strings.ToLower(named.Provider),
+				BaseURL:  named.URL,
+				Binding:  namedBinding,
+			})
+		default:
+			return nil, fmt.Errorf("ip_source %s: unknown type %q", named.Name, named.Type)
+		}
+	}
+	return sources, nil
+}
+
+// recordOptions builds the RecordOptions for one record; DNSPOD_TTL applies
+// unless the record sets its own TTL. label names the record in errors.
+func recordOptions(appCfg config.AppConfig, label, line string, ttl int64, weight *int64, remark *string) (dnspod.RecordOptions, error) {
+	opts := dnspod.RecordOptions{Line: line, Remark: remark}
+	if ttl == 0 {
+		ttl = appCfg.TTL
+	}
+	if ttl < 0 || ttl > config.MaxTTL {
+		return opts, fmt.Errorf("%s: TTL %d is outside the range %d-%d", label, ttl, config.MinTTL, config.MaxTTL)
+	}
+	opts.TTL = uint64(ttl)
+	if weight != nil {
+		if *weight < 0 || *weight > config.MaxWeight {
+			return opts, fmt.Errorf("%s: weight %d is outside the range 0-%d", label, *weight, config.MaxWeight)
+		}
+		w := uint64(*weight)
+		opts.Weight = &w
+	}
+	return opts, nil
+}
+
+// RegisterSecrets masks every secret in appCfg and its [log] redact fields
+// in log output. It is called for each loaded configuration, at startup and
+// on reload, so new secret fields only need to be added here.
+func RegisterSecrets(appCfg config.AppConfig) {
+	logger.AddSecrets(appCfg.SecretID, appCfg.SecretKey)
+	logger.AddSecrets(appCfg.Proxy.Secrets()...)
+	logger.AddSecrets(appCfg.SourceSecrets()...)
+	logger.AddSensitiveFields(appCfg.Log.Redact...)
+}
+
+// UseProxies applies the [proxy.api] and [proxy.ip_detection] settings to
+// the DNSPod client and to IP detection. Call it before UseCredentials, which
+// may already contact STS.
+func UseProxies(appCfg config.AppConfig) error {
+	apiProxy, err := appCfg.Proxy.API.Settings().Func()
+	if err != nil {
+		return fmt.Errorf("[proxy.api]: %w", err)
+	}
+	ipProxy, err := appCfg.Proxy.IPDetection.Settings().Func()
+	if err != nil {
+		return fmt.Errorf("[proxy.ip_detection]: %w", err)
+	}
+	dnspod.UseProxy(apiProxy)
+	ipfetcher.UseProxy(ipProxy)
+	return nil
+}
+
+// UseCredentials configures dnspod API credentials from appCfg's
+// CREDENTIAL_SOURCE settings.
+func UseCredentials(appCfg config.AppConfig) error {
+	duration, err := appCfg.STSSessionDuration()
+	if err != nil {
+		return err
+	}
+	return dnspod.UseCredentials(dnspod.CredentialOptions{
+		Source:      appCfg.CredentialSource,
+		SecretID:    appCfg.SecretID,
+		SecretKey:   appCfg.SecretKey,
+		RoleName:    appCfg.CVMRoleName,
+		MetadataURL: appCfg.MetadataURL,
+		RoleArn:     appCfg.STSRoleArn,
+		SessionName: appCfg.STSSessionName,
+		Duration:    duration,
+	})
+}
@@ -0,0 +1,143 @@
+package servicerunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ddns-dnspod/dnspod"
+)
+
+// State is the outcome of the most recent update cycles, persisted so that
+// the `status` command can report it from another process.
+type State struct {
+	PID           int         `json:"pid"`
+	StartedAt     time.Time   `json:"started_at"`
+	LastRunAt     time.Time   `json:"last_run_at"`
+	LastSuccessAt time.Time   `json:"last_success_at"`
+	LastError     string      `json:"last_error,omitempty"`
+	LastErrorAt   time.Time   `json:"last_error_at"`
+	DryRun        bool        `json:"dry_run"`
+	IPv4          FamilyState `json:"ipv4"`
+	IPv6          FamilyState `json:"ipv6"`
+
+	Records []FamilyState `json:"records,omitempty"` // The [[record]] tables, in config order
+}
+
+// FamilyState tracks the A or AAAA record, or one [[record]] table.
+type FamilyState struct {
+	RecordID    int64     `json:"record_id,omitempty"`
+	RecordType  string    `json:"record_type,omitempty"` // Only set for [[record]] entries
+	SubDomain   string    `json:"sub_domain,omitempty"`  // Only set for [[record]] entries
+	Line        string    `json:"line,omitempty"`        // Only set for [[record]] entries
+	DetectedIP  string    `json:"detected_ip,omitempty"`
+	PublishedIP string    `json:"published_ip,omitempty"` // Kept across failed cycles
+	PublishedAt time.Time `json:"published_at"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// DefaultStatePath returns the state file used when STATE_FILE is not set:
+// <service name>.state.json next to the executable.
+func DefaultStatePath(name string) (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exePath), name+".state.json"), nil
+}
+
+// LoadState reads the state file at path.
+func LoadState(path string) (State, error) {
+	var st State
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+// Save writes the state atomically, so readers never see a partial file.
+// The file is only readable by the service's user (mode 0600), as the
+// detected addresses and errors are not meant for other local users.
+func (st State) Save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	// CreateTemp uses mode 0600 and a fresh name, so a leftover file from an
+	// interrupted write cannot lend its permissions to the state.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// record merges the result of one update cycle into the state.
+func (st *State) record(result dnspod.UpdateResult, now time.Time) {
+	st.LastRunAt = now
+	st.LastError = ""
+	for _, f := range []struct {
+		state  *FamilyState
+		result dnspod.FamilyResult
+	}{
+		{&st.IPv4, result.IPv4},
+		{&st.IPv6, result.IPv6},
+	} {
+		f.state.merge(f.result, now)
+		if f.state.LastError != "" && f.result.RecordID != 0 && st.LastError == "" {
+			st.LastError = f.result.RecordType + ": " + f.state.LastError
+		}
+	}
+
+	// Records are matched by ID, so the last published address survives
+	// the config being reordered or edited between cycles.
+	previous := make(map[int64]FamilyState, len(st.Records))
+	for _, r := range st.Records {
+		previous[r.RecordID] = r
+	}
+	records := make([]FamilyState, 0, len(result.Records))
+	for _, r := range result.Records {
+		fs := previous[r.RecordID]
+		fs.RecordType, fs.SubDomain, fs.Line = r.RecordType, r.SubDomain, r.Line
+		fs.merge(r, now)
+		if fs.LastError != "" && st.LastError == "" {
+			st.LastError = fmt.Sprintf("%s record %d: %s", r.RecordType, r.RecordID, fs.LastError)
+		}
+		records = append(records, fs)
+	}
+	st.Records = records
+
+	if st.LastError != "" {
+		st.LastErrorAt = now
+	} else {
+		st.LastSuccessAt = now
+	}
+}
+
+// merge applies the result of one cycle to a single record's state.
+func (f *FamilyState) merge(result dnspod.FamilyResult, now time.Time) {
+	f.RecordID = result.RecordID
+	f.DetectedIP = result.IP
+	f.LastError = ""
+	if result.Err != nil {
+		f.LastError = result.Err.Error()
+	}
+	if result.Published {
+		f.PublishedIP = result.IP
+		f.PublishedAt = now
+	}
+}
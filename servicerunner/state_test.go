@@ -0,0 +1,140 @@
+package servicerunner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"ddns-dnspod/dnspod"
+)
+
+func TestStateRecordSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ddns.state.json")
+	first := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(5 * time.Minute)
+
+	st := State{PID: 42, StartedAt: first}
+	st.record(dnspod.UpdateResult{
+		IPv4: dnspod.FamilyResult{RecordType: "A", RecordID: 1, IP: "203.0.113.7", Published: true},
+		IPv6: dnspod.FamilyResult{RecordType: "AAAA", RecordID: 2, Err: errors.New("no IPv6 address")},
+		Records: []dnspod.FamilyResult{
+			{RecordType: "A", RecordID: 10, SubDomain: "www", IP: "203.0.113.7", Published: true},
+			{RecordType: "A", RecordID: 11, SubDomain: "vpn", Line: "电信", IP: "203.0.113.7", Published: true},
+		},
+	}, first)
+	if err := st.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PID != 42 || !got.LastRunAt.Equal(first) || !got.LastErrorAt.Equal(first) || !got.LastSuccessAt.IsZero() {
+		t.Errorf("loaded state = %+v", got)
+	}
+	if got.LastError != "AAAA: no IPv6 address" {
+		t.Errorf("LastError = %q", got.LastError)
+	}
+	if got.IPv4.PublishedIP != "203.0.113.7" || !got.IPv4.PublishedAt.Equal(first) || got.IPv4.LastError != "" {
+		t.Errorf("IPv4 = %+v", got.IPv4)
+	}
+	if got.IPv6.PublishedIP != "" || got.IPv6.LastError != "no IPv6 address" {
+		t.Errorf("IPv6 = %+v", got.IPv6)
+	}
+	if len(got.Records) != 2 || got.Records[1].SubDomain != "vpn" || got.Records[1].Line != "电信" {
+		t.Errorf("Records = %+v", got.Records)
+	}
+
+	// The next cycle: IPv4 fails, so its last published address is kept;
+	// IPv6 succeeds. The [[record]] tables were reordered in the config.
+	got.record(dnspod.UpdateResult{
+		IPv4: dnspod.FamilyResult{RecordType: "A", RecordID: 1, IP: "198.51.100.1", Err: errors.New("ModifyRecord failed")},
+		IPv6: dnspod.FamilyResult{RecordType: "AAAA", RecordID: 2, IP: "2001:db8::1", Published: true},
+		Records: []dnspod.FamilyResult{
+			{RecordType: "A", RecordID: 11, SubDomain: "vpn", IP: "198.51.100.1"},
+			{RecordType: "A", RecordID: 10, SubDomain: "www", IP: "198.51.100.1", Published: true},
+		},
+	}, second)
+	if err := got.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IPv4.DetectedIP != "198.51.100.1" || got.IPv4.PublishedIP != "203.0.113.7" || !got.IPv4.PublishedAt.Equal(first) ||
+		got.IPv4.LastError != "ModifyRecord failed" {
+		t.Errorf("IPv4 after a failed cycle = %+v", got.IPv4)
+	}
+	if got.IPv6.PublishedIP != "2001:db8::1" || !got.IPv6.PublishedAt.Equal(second) || got.IPv6.LastError != "" {
+		t.Errorf("IPv6 after a successful cycle = %+v", got.IPv6)
+	}
+	if got.LastError != "A: ModifyRecord failed" || !got.LastErrorAt.Equal(second) {
+		t.Errorf("LastError = %q at %s", got.LastError, got.LastErrorAt)
+	}
+	if vpn := got.Records[0]; vpn.RecordID != 11 || vpn.PublishedIP != "203.0.113.7" || vpn.Line != "" {
+		t.Errorf("vpn record = %+v, want the earlier published address kept", vpn)
+	}
+	if www := got.Records[1]; www.RecordID != 10 || www.PublishedIP != "198.51.100.1" || !www.PublishedAt.Equal(second) {
+		t.Errorf("www record = %+v", www)
+	}
+}
+
+func TestStateSaveIsAtomicAndPrivate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ddns.state.json")
+	// A state file written by an older version, readable by everyone.
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers must always see a complete file while it is rewritten.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := LoadState(path); err != nil {
+				t.Errorf("LoadState() during Save: %v", err)
+				return
+			}
+		}
+	}()
+	st := State{PID: 1}
+	for i := 0; i < 200; i++ {
+		st.Records = append(st.Records, FamilyState{RecordID: int64(i), DetectedIP: "203.0.113.7"})
+		if err := st.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got, err := LoadState(path); err != nil || len(got.Records) != 200 {
+		t.Fatalf("LoadState() = %d records, %v", len(got.Records), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %v, want only the state file", entries)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("state file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+		}
+	}
+
+	// Errors are reported rather than leaving a stray temporary file.
+	if err := st.Save(filepath.Join(dir, "missing", "ddns.state.json")); err == nil {
+		t.Error("Save() into a missing directory succeeded")
+	}
+}